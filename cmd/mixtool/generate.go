@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -95,6 +96,39 @@ func generateCommand() cli.Command {
 				),
 				Action: generateAction(generateAll),
 			},
+			cli.Command{
+				Name:        "docs",
+				Usage:       "Generate documentation of the alerts, recording rules and dashboards of the mixins",
+				Description: "Render the alerts of each mixin with their expression, duration, severity, summary, description and runbook, its recording rules and its dashboards as markdown or HTML, with the built-in template of the format or a Go template given by --template",
+				ArgsUsage:   "<mixin>...",
+				Flags: []cli.Flag{
+					cli.StringSliceFlag{
+						Name: "jpath, J",
+					},
+					cli.StringFlag{
+						Name:  "format, f",
+						Usage: "Format of the documentation, one of " + strings.Join(mixer.DocsFormats, ", "),
+						Value: "markdown",
+					},
+					cli.StringFlag{
+						Name:  "template, t",
+						Usage: "Go template to render the documentation with instead of the built-in template of the format",
+					},
+					cli.StringFlag{
+						Name:  "name",
+						Usage: "Title of the documentation of a single mixin, the name of its directory by default",
+					},
+					cli.StringFlag{
+						Name:  "output-docs, o",
+						Usage: "The file where the documentation of a single mixin is written",
+					},
+					cli.StringFlag{
+						Name:  "directory, d",
+						Usage: "The directory where the documentation of each mixin is written to, named after the mixin",
+					},
+				},
+				Action: generateDocsAction,
+			},
 		},
 	}
 }
@@ -195,14 +229,6 @@ func generateDashboards(filename string, opts mixer.GenerateOptions) error {
 	return nil
 }
 
-func generateRulesAlerts(filename string, options mixer.GenerateOptions) ([]byte, error) {
-	out, err := mixer.GenerateRulesAlerts(filename, options)
-	if err != nil {
-		return nil, err
-	}
-	return out, nil
-}
-
 func generateAll(filename string, opts mixer.GenerateOptions) error {
 	if err := generateAlerts(filename, opts); err != nil {
 		return err
@@ -218,3 +244,59 @@ func generateAll(filename string, opts mixer.GenerateOptions) error {
 
 	return nil
 }
+
+func generateDocsAction(c *cli.Context) error {
+	filenames := c.Args()
+	if len(filenames) == 0 {
+		return fmt.Errorf("no jsonnet file given")
+	}
+	if len(filenames) > 1 && (c.String("output-docs") != "" || c.String("name") != "") {
+		return fmt.Errorf("--output-docs and --name are only allowed for a single mixin, use --directory instead")
+	}
+
+	extension := ".md"
+	if c.String("format") == "html" {
+		extension = ".html"
+	}
+
+	for _, filename := range filenames {
+		jPaths, err := availableVendor(filename, c.StringSlice("jpath"))
+		if err != nil {
+			return err
+		}
+		opts := mixer.DocsOptions{
+			JPaths:   jPaths,
+			Name:     c.String("name"),
+			Format:   c.String("format"),
+			Template: c.String("template"),
+		}
+		if opts.Name == "" {
+			abs, err := filepath.Abs(filename)
+			if err != nil {
+				return err
+			}
+			opts.Name = filepath.Base(filepath.Dir(abs))
+		}
+
+		out, err := mixer.GenerateDocs(filename, opts)
+		if err != nil {
+			return fmt.Errorf("failed to generate documentation of %s: %w", filename, err)
+		}
+
+		output := c.String("output-docs")
+		if dir := c.String("directory"); dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			output = filepath.Join(dir, opts.Name+extension)
+		}
+		if output == "" || output == "-" {
+			output = "/dev/stdout"
+		}
+		if err := os.WriteFile(output, out, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
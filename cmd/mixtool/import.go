@@ -0,0 +1,106 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+
+	"github.com/urfave/cli"
+)
+
+func importCommand() cli.Command {
+	return cli.Command{
+		Name:        "import",
+		Usage:       "Convert Prometheus rule files and Grafana dashboards into a mixin",
+		Description: "Convert Prometheus rule files (.yaml, .yml) and Grafana dashboards exported as JSON (.json) into the jsonnet of a new mixin in --directory, extracting repeated label selectors into its _config",
+		ArgsUsage:   "<file>...",
+		Action:      importAction,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "directory, d",
+				Usage: "Path of the directory to create the mixin in, which must be empty",
+			},
+			cli.IntFlag{
+				Name:  "min-selector-uses",
+				Usage: "Number of expressions a label matcher has to be used in to be extracted into _config",
+				Value: mixer.DefaultMinSelectorUses,
+			},
+		},
+	}
+}
+
+func importAction(c *cli.Context) error {
+	if len(c.Args()) == 0 {
+		return fmt.Errorf("expected at least one rule file or dashboard to import")
+	}
+	dir := c.String("directory")
+	if dir == "" {
+		return fmt.Errorf("expected the directory to create the mixin in with --directory")
+	}
+	if c.Int("min-selector-uses") < 1 {
+		return fmt.Errorf("--min-selector-uses must be at least 1")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("directory %s is not empty. not overwriting", dir)
+	}
+
+	opts := mixer.ImportOptions{MinSelectorUses: c.Int("min-selector-uses")}
+	for _, filename := range c.Args() {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".yaml", ".yml":
+			opts.RuleFiles = append(opts.RuleFiles, filename)
+		case ".json":
+			opts.DashboardFiles = append(opts.DashboardFiles, filename)
+		default:
+			return fmt.Errorf("unknown type of file %s, expected a rule file (.yaml, .yml) or dashboard (.json)", filename)
+		}
+	}
+
+	files, err := mixer.Import(opts)
+	if err != nil {
+		return err
+	}
+
+	var filenames []string
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		path := filepath.Join(dir, filename)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, files[filename], 0644); err != nil {
+			return fmt.Errorf("failed to create file %s: %v", path, err)
+		}
+		fmt.Println("Created", path)
+	}
+
+	fmt.Printf("Imported %d rule files and %d dashboards into %s\n", len(opts.RuleFiles), len(opts.DashboardFiles), filepath.Join(dir, "mixin.libsonnet"))
+	return nil
+}
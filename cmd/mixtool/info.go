@@ -0,0 +1,193 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/monitoring-mixins/mixtool/pkg/installer"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+
+	"github.com/urfave/cli"
+)
+
+func infoCommand() cli.Command {
+	return cli.Command{
+		Name:        "info",
+		Usage:       "Show the contents of a mixin",
+		Description: "Show the alerts, recording rules, dashboards and configuration of a mixin, given by the path to its file or directory, by the name of a mixin installed into --directory, or by the name of a mixin in the registry, which is fetched into a temporary directory",
+		ArgsUsage:   "<name|path>",
+		Action:      infoAction,
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "directory, d",
+				Usage: "Path the mixin has been installed into, when given by name",
+			},
+			cli.StringSliceFlag{
+				Name:  "jpath, J",
+				Usage: "Add folders to be used as vendor folders",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Output format, one of text or json",
+				Value: "text",
+			},
+		}, registryFlags...),
+	}
+}
+
+func infoAction(c *cli.Context) error {
+	arg := c.Args().First()
+	if arg == "" {
+		return fmt.Errorf("expected the name of a mixin or the path to a mixin")
+	}
+
+	filename, jPaths, cleanup, err := infoMixinFile(arg, c.String("directory"), c.StringSlice("jpath"), func() ([]mixin, error) { return getMixins(c) })
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := mixer.Describe(filename, mixer.GenerateOptions{JPaths: jPaths})
+	if err != nil {
+		return fmt.Errorf("failed to evaluate mixin %s: %w", filename, err)
+	}
+
+	switch c.String("output") {
+	case "", "text":
+		return printInfo(os.Stdout, info)
+	case "json":
+		out, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected text or json", c.String("output"))
+}
+
+// infoMixinFile returns the mixin file arg refers to and the jpaths to
+// evaluate it with. Paths are told apart by their syntax like by install,
+// or by the extension of a jsonnet file. A directory refers to its
+// mixin.libsonnet, anything that is not a path is the name of a mixin
+// installed into directory or, if it is not installed, of a mixin in the
+// registries returned by mixins.
+// Mixins from a registry are installed into a temporary directory, which
+// cleanup removes.
+func infoMixinFile(arg, directory string, jPaths []string, mixins func() ([]mixin, error)) (string, []string, func(), error) {
+	cleanup := func() {}
+
+	if isLocalPath(arg) || isJsonnetFile(arg) {
+		stat, err := os.Stat(arg)
+		if err != nil {
+			return "", nil, cleanup, err
+		}
+		filename := arg
+		if stat.IsDir() {
+			filename = filepath.Join(arg, "mixin.libsonnet")
+		}
+		jPaths, err := availableVendor(filename, jPaths)
+		return filename, jPaths, cleanup, err
+	}
+
+	if directory != "" {
+		result, err := installer.Lookup(arg, installer.Options{Directory: directory})
+		if err == nil {
+			if len(jPaths) == 0 {
+				// The vendor directory of an installed mixin may have its own
+				// jsonnetfile, so the one of the install directory is used.
+				jPaths = []string{filepath.Join(directory, "vendor")}
+			}
+			return result.MixinFile, jPaths, cleanup, nil
+		}
+	}
+
+	name, version := installer.SplitVersion(arg)
+	source, version, err := resolveMixin(name, version, mixins)
+	if err != nil {
+		return "", nil, cleanup, fmt.Errorf("%s is neither a path nor an installed mixin: %w", arg, err)
+	}
+	tmp, err := os.MkdirTemp("", "mixtool-info")
+	if err != nil {
+		return "", nil, cleanup, err
+	}
+	cleanup = func() { _ = os.RemoveAll(tmp) }
+	result, err := installer.Install(source, installer.Options{Directory: tmp, Version: version})
+	if err != nil {
+		cleanup()
+		return "", nil, func() {}, fmt.Errorf("failed to fetch mixin %s: %w", arg, err)
+	}
+	if len(jPaths) == 0 {
+		jPaths = []string{filepath.Join(tmp, "vendor")}
+	}
+	return result.MixinFile, jPaths, cleanup, nil
+}
+
+// isJsonnetFile reports whether filename has the extension of a jsonnet
+// file.
+func isJsonnetFile(filename string) bool {
+	ext := filepath.Ext(filename)
+	return ext == ".libsonnet" || ext == ".jsonnet"
+}
+
+func printInfo(w io.Writer, info *mixer.Info) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	alerts := 0
+	for _, g := range info.AlertGroups {
+		alerts += len(g.Alerts)
+	}
+	_, _ = fmt.Fprintf(tw, "Alerts: %d in %d groups\n", alerts, len(info.AlertGroups))
+	for _, g := range info.AlertGroups {
+		_, _ = fmt.Fprintf(tw, "  %s\n", g.Name)
+		for _, a := range g.Alerts {
+			severity := a.Severity
+			if severity == "" {
+				severity = "-"
+			}
+			_, _ = fmt.Fprintf(tw, "    %s\t%s\n", a.Name, severity)
+		}
+	}
+
+	records := 0
+	for _, g := range info.RuleGroups {
+		records += len(g.Records)
+	}
+	_, _ = fmt.Fprintf(tw, "\nRecording rules: %d in %d groups\n", records, len(info.RuleGroups))
+	for _, g := range info.RuleGroups {
+		_, _ = fmt.Fprintf(tw, "  %s\n", g.Name)
+		for _, r := range g.Records {
+			_, _ = fmt.Fprintf(tw, "    %s\n", r)
+		}
+	}
+
+	_, _ = fmt.Fprintf(tw, "\nDashboards: %d\n", len(info.Dashboards))
+	for _, d := range info.Dashboards {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\tuid=%s\n", d.Filename, d.Title, d.UID)
+	}
+
+	_, _ = fmt.Fprintf(tw, "\nConfig: %d keys\n", len(info.Config))
+	for _, cfg := range info.Config {
+		_, _ = fmt.Fprintf(tw, "  %s\t%s\n", cfg.Key, cfg.Default)
+	}
+
+	return tw.Flush()
+}
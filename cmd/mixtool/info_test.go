@@ -0,0 +1,115 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/monitoring-mixins/mixtool/pkg/installer"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfoMixinFile(t *testing.T) {
+	mixinDir := filepath.Join(t.TempDir(), "info-mixin")
+	require.NoError(t, os.MkdirAll(mixinDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mixinDir, "mixin.libsonnet"), []byte("{}"), 0644))
+	noMixins := func() ([]mixin, error) { return nil, nil }
+
+	filename, _, cleanup, err := infoMixinFile(mixinDir, "", nil, noMixins)
+	require.NoError(t, err)
+	cleanup()
+	assert.Equal(t, filepath.Join(mixinDir, "mixin.libsonnet"), filename)
+
+	// Files in the working directory named like a mixin do not shadow the
+	// registry, unless they are given as a path.
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(filepath.Dir(mixinDir)))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+
+	_, _, _, err = infoMixinFile("info-mixin", "", nil, noMixins)
+	assert.EqualError(t, err, "info-mixin is neither a path nor an installed mixin: could not find mixin with name info-mixin")
+
+	filename, _, cleanup, err = infoMixinFile("./info-mixin", "", nil, noMixins)
+	require.NoError(t, err)
+	cleanup()
+	assert.Equal(t, filepath.Join("info-mixin", "mixin.libsonnet"), filename)
+
+	filename, _, cleanup, err = infoMixinFile(filepath.Join("info-mixin", "mixin.libsonnet"), "", nil, noMixins)
+	require.NoError(t, err)
+	cleanup()
+	assert.Equal(t, filepath.Join("info-mixin", "mixin.libsonnet"), filename)
+
+	_, _, _, err = infoMixinFile("./missing", "", nil, noMixins)
+	assert.True(t, os.IsNotExist(err))
+
+	dir := t.TempDir()
+	_, err = installer.Install(mixinDir, installer.Options{Directory: dir})
+	require.NoError(t, err)
+
+	filename, jPaths, cleanup, err := infoMixinFile("info-mixin", dir, nil, noMixins)
+	require.NoError(t, err)
+	cleanup()
+	assert.Equal(t, filepath.Join(dir, "vendor", "info-mixin", "mixin.libsonnet"), filename)
+	assert.Equal(t, []string{filepath.Join(dir, "vendor")}, jPaths)
+}
+
+func TestInfoMixinFileRegistry(t *testing.T) {
+	mixinDir := filepath.Join(t.TempDir(), "info-mixin")
+	require.NoError(t, os.MkdirAll(mixinDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mixinDir, "mixin.libsonnet"), []byte(`{
+  prometheusAlerts+:: { groups+: [{ name: 'info', rules: [{ alert: 'InfoDown', expr: 'up == 0' }] }] },
+}`), 0644))
+
+	// A registry listing the mixin, which is not installed into the directory.
+	registry := func() ([]mixin, error) {
+		return []mixin{{Name: "info", URL: filepath.Dir(mixinDir), Subdir: "info-mixin"}}, nil
+	}
+	filename, jPaths, cleanup, err := infoMixinFile("info", t.TempDir(), nil, registry)
+	require.NoError(t, err)
+
+	info, err := mixer.Describe(filename, mixer.GenerateOptions{JPaths: jPaths})
+	require.NoError(t, err)
+	assert.Equal(t, []mixer.AlertGroupInfo{{Name: "info", Alerts: []mixer.AlertInfo{{Name: "InfoDown"}}}}, info.AlertGroups)
+
+	// The mixin is fetched into a temporary directory, removed by cleanup.
+	_, err = os.Stat(filename)
+	require.NoError(t, err)
+	cleanup()
+	_, err = os.Stat(filename)
+	assert.True(t, os.IsNotExist(err), "expected %s to be removed", filename)
+}
+
+func TestPrintInfo(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, printInfo(&b, &mixer.Info{
+		AlertGroups: []mixer.AlertGroupInfo{{Name: "example", Alerts: []mixer.AlertInfo{{Name: "ExampleDown", Severity: "critical"}}}},
+		Dashboards:  []mixer.DashboardInfo{{Filename: "example.json", Title: "Example", UID: "abc"}},
+		Config:      []mixer.ConfigInfo{{Key: "selector", Default: json.RawMessage(`"job=\"example\""`)}},
+	}))
+
+	out := b.String()
+	assert.Contains(t, out, "Alerts: 1 in 1 groups\n")
+	assert.Contains(t, out, "ExampleDown  critical\n")
+	assert.Contains(t, out, "Recording rules: 0 in 0 groups\n")
+	assert.Contains(t, out, "example.json  Example  uid=abc\n")
+	assert.Contains(t, out, `selector  "job=\"example\""`)
+}
@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -23,9 +24,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
-	"github.com/monitoring-mixins/mixtool/pkg/jsonnetbundler"
+	"github.com/monitoring-mixins/mixtool/pkg/installer"
 	"github.com/monitoring-mixins/mixtool/pkg/mixer"
 
 	"github.com/urfave/cli"
@@ -35,9 +37,9 @@ func installCommand() cli.Command {
 	return cli.Command{
 		Name:        "install",
 		Usage:       "Install a mixin",
-		Description: "Install a mixin from a repository",
+		Description: "Install a mixin from the registry by name, from a git URL including SSH URLs, from a local directory or from a tarball. Append @ and a tag, branch or commit to the name or URL to install a specific version",
 		Action:      installAction,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:  "bind-address",
 				Usage: "Address to bind HTTP server to.",
@@ -45,194 +47,265 @@ func installCommand() cli.Command {
 			},
 			cli.StringFlag{
 				Name:  "directory, d",
-				Usage: "Path where the downloaded mixin is saved. If it doesn't exist already it will be created",
+				Usage: "Path where the downloaded mixin is saved. If it doesn't exist already it will be created, otherwise the mixin is added to the ones installed before",
 			},
 			cli.BoolFlag{
 				Name:  "put, p",
 				Usage: "Specify this flag when you want to send PUT request to mixtool server once the mixins are generated",
 			},
-		},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Show the changes to the rules --put would make on mixtool server, without applying them",
+			},
+			cli.BoolFlag{
+				Name:  "put-dashboards",
+				Usage: "Specify this flag when you want to send the generated dashboards to mixtool server as well",
+			},
+			cli.StringFlag{
+				Name:  "folder",
+				Usage: "Grafana folder mixtool server provisions the dashboards into",
+			},
+			cli.StringFlag{
+				Name:  "bearer-token-file",
+				Usage: "File containing the bearer token to authenticate the PUT request to mixtool server with",
+			},
+		}, registryFlags...),
 	}
 }
 
-// Downloads a mixin from a given repository given by url and places into directory
-// by running jb init and jb install
-func downloadMixin(url string, jsonnetHome string, directory string) error {
-	// intialize the jsonnet bundler library
-	err := jsonnetbundler.InitCommand(directory)
+// putMixin sends the rules in content to mixtool server. With dryRun, the
+// server only validates them and the changes they would make are printed.
+func putMixin(content []byte, bindAddress string, bearerToken string, dryRun bool) error {
+	u, err := url.Parse(bindAddress)
 	if err != nil {
-		return fmt.Errorf("jsonnet bundler init failed %v", err)
+		return err
 	}
-
-	// by default, set the single flag to false
-	err = jsonnetbundler.InstallCommand(directory, jsonnetHome, []string{url}, false)
-	if err != nil {
-		return fmt.Errorf("jsonnet bundler install failed %v", err)
+	u.Path = path.Join(u.Path, "/api/v1/rules")
+	if dryRun {
+		u.RawQuery = url.Values{"dry_run": []string{"true"}}.Encode()
 	}
 
-	return nil
-}
-
-// Gets mixins from default website - mostly copied from list.go
-func getMixins() ([]mixin, error) {
-	body, err := queryWebsite(defaultWebsite)
+	r := bytes.NewReader(content)
+	req, err := http.NewRequest("PUT", u.String(), r)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	mixins, err := parseMixinJSON(body)
-	if err != nil {
-		return nil, err
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
 	}
-	return mixins, nil
-}
-
-func generateMixin(directory string, jsonnetHome string, mixinURL string, options mixer.GenerateOptions) ([]byte, error) {
-
-	mixinBaseDirectory := filepath.Join(directory)
 
-	err := os.Chdir(mixinBaseDirectory)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("cannot cd into directory %s", err)
+		return fmt.Errorf("response from server %v", err)
 	}
+	defer func() { _ = resp.Body.Close() }()
 
-	// generate alerts, rules, grafana dashboards
-	// empty files if not present
-
-	u, err := url.Parse(mixinURL)
-	if err != nil {
-		return nil, fmt.Errorf("url parse %v", err)
+	if resp.StatusCode != 200 {
+		responseData, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to response body in putMixin, %w", err)
+		}
+		return fmt.Errorf("non 200 response code: %d, info: %s", resp.StatusCode, string(responseData))
 	}
 
-	// absolute directory is the same as the download url stripped of the scheme
-	absDirectory := path.Join(u.Host, u.Path)
-	absDirectory = strings.TrimLeft(absDirectory, "/:")
-	absDirectory = strings.TrimSuffix(absDirectory, ".git")
-
-	importFile := filepath.Join(absDirectory, "mixin.libsonnet")
+	if !dryRun {
+		fmt.Println("PUT alerts OK")
+		return nil
+	}
 
-	// generate rules, dashboards, alerts
-	err = generateAll(importFile, options)
-	if err != nil {
-		return nil, fmt.Errorf("generateAll: %w", err)
+	var diff mixer.RulesDiff
+	if err := json.NewDecoder(resp.Body).Decode(&diff); err != nil {
+		return fmt.Errorf("failed to decode rules diff: %w", err)
 	}
+	if diff.Empty() {
+		fmt.Println("No changes to alerts")
+	} else {
+		fmt.Print(diff.String())
+	}
+	return nil
+}
 
-	out, err := generateRulesAlerts(importFile, options)
+// putDashboards sends all dashboards found in directory to mixtool server.
+func putDashboards(directory string, bindAddress string, folder string, bearerToken string) error {
+	files, err := os.ReadDir(directory)
 	if err != nil {
-		return nil, fmt.Errorf("generateRulesAlerts %w", err)
+		return fmt.Errorf("failed to read dashboards: %w", err)
 	}
 
-	return out, nil
+	dashboards := map[string]json.RawMessage{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(directory, f.Name()))
+		if err != nil {
+			return err
+		}
+		dashboards[f.Name()] = content
+	}
 
-}
+	body, err := json.Marshal(dashboards)
+	if err != nil {
+		return err
+	}
 
-func putMixin(content []byte, bindAddress string) error {
 	u, err := url.Parse(bindAddress)
 	if err != nil {
 		return err
 	}
-	u.Path = path.Join(u.Path, "/api/v1/rules")
+	u.Path = path.Join(u.Path, "/api/v1/dashboards")
+	if folder != "" {
+		u.RawQuery = url.Values{"folder": []string{folder}}.Encode()
+	}
 
-	r := bytes.NewReader(content)
-	req, err := http.NewRequest("PUT", u.String(), r)
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("response from server %v", err)
 	}
-	if resp.StatusCode == 200 {
-		fmt.Println("PUT alerts OK")
-	} else {
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != 200 {
 		responseData, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return fmt.Errorf("failed to response body in putMixin, %w", err)
+			return fmt.Errorf("failed to response body in putDashboards, %w", err)
 		}
 		return fmt.Errorf("non 200 response code: %d, info: %s", resp.StatusCode, string(responseData))
 	}
+	fmt.Printf("PUT %d dashboards OK\n", len(dashboards))
 	return nil
 }
 
-func installAction(c *cli.Context) error {
-	directory := c.String("directory")
-	if directory == "" {
-		return fmt.Errorf("must specify a directory to download mixin")
-	}
+// scpURL matches git URLs in the scp-like SSH syntax, user@host:path.
+var scpURL = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
 
-	_, err := os.Stat(directory)
-	if os.IsNotExist(err) {
-		err = os.MkdirAll(directory, 0755)
-		if err != nil {
-			return fmt.Errorf("could not create directory %v", err)
+// isGitURL reports whether mixin is the URL of a git repository rather
+// than the name of a mixin in the registry. Names in the registry never
+// contain a slash, so URLs without a scheme like github.com/org/repo are
+// recognized as well.
+func isGitURL(mixin string) bool {
+	return scpURL.MatchString(mixin) || strings.Contains(mixin, "/")
+}
+
+// isLocalPath reports whether mixin is explicitly the path of a local
+// directory or tarball, by its syntax alone: a path starting with ./, ../
+// or /, or the name of a tarball. Other arguments are git URLs or looked up
+// in the registry, even if a file of the same name exists in the working
+// directory.
+func isLocalPath(mixin string) bool {
+	if mixin == "." || mixin == ".." || filepath.IsAbs(mixin) {
+		return true
+	}
+	for _, prefix := range []string{"./", "../", "." + string(filepath.Separator), ".." + string(filepath.Separator)} {
+		if strings.HasPrefix(mixin, prefix) {
+			return true
 		}
 	}
+	return installer.IsTarball(mixin) && !strings.Contains(mixin, "://") && !scpURL.MatchString(mixin)
+}
 
-	mixinPath := c.Args().First()
-	if mixinPath == "" {
-		return fmt.Errorf("expected the url of mixin repository or name of the mixin. Show available mixins using mixtool list")
+// resolveMixin returns the source to install mixinPath from, a local path,
+// a git URL or the name of a mixin in the registries returned by mixins,
+// with the version to install.
+func resolveMixin(mixinPath, version string, mixins func() ([]mixin, error)) (string, string, error) {
+	if isLocalPath(mixinPath) {
+		if _, err := os.Stat(mixinPath); err != nil {
+			if os.IsNotExist(err) {
+				return "", "", fmt.Errorf("no such directory or tarball %s", mixinPath)
+			}
+			return "", "", err
+		}
+		return mixinPath, version, nil
+	}
+	if isGitURL(mixinPath) {
+		return mixinPath, version, nil
 	}
 
-	mixinsList, err := getMixins()
+	mixinsList, err := mixins()
 	if err != nil {
-		return fmt.Errorf("getMixins failed %v", err)
-	}
-
-	var mixinURL string
-	if _, err := url.ParseRequestURI(mixinPath); err != nil {
-		// check if the name exists in mixinsList
-		found := false
-		for _, m := range mixinsList {
-			if m.Name == mixinPath {
-				// join paths together
-				u, err := url.Parse(m.URL)
-				if err != nil {
-					return fmt.Errorf("url parse failed %v", err)
-				}
-				u.Path = path.Join(u.Path, m.Subdir)
-				mixinURL = u.String()
-				found = true
-				break
+		return "", "", fmt.Errorf("getMixins failed %v", err)
+	}
+
+	// check if the name exists in mixinsList
+	for _, m := range mixinsList {
+		if m.Name == mixinPath {
+			// join paths together
+			u, err := url.Parse(m.URL)
+			if err != nil {
+				return "", "", fmt.Errorf("url parse failed %v", err)
 			}
+			u.Path = path.Join(u.Path, m.Subdir)
+			if version == "" {
+				version = m.Version
+			}
+			return u.String(), version, nil
 		}
-		if !found {
-			return fmt.Errorf("could not find mixin with name %s", mixinPath)
-		}
-	} else {
-		mixinURL = mixinPath
 	}
+	return "", "", fmt.Errorf("could not find mixin with name %s", mixinPath)
+}
 
-	if mixinURL == "" {
-		return fmt.Errorf("empty mixinURL")
+func installAction(c *cli.Context) error {
+	directory := c.String("directory")
+	if directory == "" {
+		return fmt.Errorf("must specify a directory to download mixin")
 	}
 
-	// by default jsonnet packages are downloaded under vendor
-	jsonnetHome := "vendor"
+	dryRun := c.Bool("dry-run")
+	if dryRun && !c.Bool("put") {
+		return fmt.Errorf("--dry-run requires --put")
+	}
 
-	err = downloadMixin(mixinURL, jsonnetHome, directory)
-	if err != nil {
-		return err
+	mixinPath, version := installer.SplitVersion(c.Args().First())
+	if mixinPath == "" {
+		return fmt.Errorf("expected the url of mixin repository or name of the mixin. Show available mixins using mixtool list")
 	}
 
-	generateCfg := mixer.GenerateOptions{
-		AlertsFilename: "alerts.yaml",
-		RulesFilename:  "rules.yaml",
-		Directory:      "dashboards_out",
-		JPaths:         []string{"./vendor"},
-		YAML:           true,
+	mixinURL, version, err := resolveMixin(mixinPath, version, func() ([]mixin, error) { return getMixins(c) })
+	if err != nil {
+		return err
 	}
 
-	rulesAlerts, err := generateMixin(directory, jsonnetHome, mixinURL, generateCfg)
+	result, err := installer.Install(mixinURL, installer.Options{Directory: directory, Version: version})
 	if err != nil {
 		return err
 	}
+	if result.Version != "" {
+		fmt.Printf("Installed %s at %s into %s\n", mixinURL, result.Version, result.Directory)
+	} else {
+		fmt.Printf("Installed %s into %s\n", mixinURL, result.Directory)
+	}
 
 	// check if put address flag was set
 
+	bindAddress := c.String("bind-address")
+
+	var bearerToken string
+	if tokenFile := c.String("bearer-token-file"); tokenFile != "" {
+		bearerToken, err = readBearerToken(tokenFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	if c.Bool("put") {
-		bindAddress := c.String("bind-address")
 		// run put requests onto the server
-		err = putMixin(rulesAlerts, bindAddress)
+		err = putMixin(result.RulesAlerts, bindAddress, bearerToken, dryRun)
+		if err != nil {
+			return err
+		}
+	}
+
+	// dashboards are not diffed, a dry run leaves them untouched
+	if c.Bool("put-dashboards") && !dryRun {
+		err = putDashboards(result.DashboardsDirectory, bindAddress, c.String("folder"), bearerToken)
 		if err != nil {
 			return err
 		}
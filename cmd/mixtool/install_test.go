@@ -16,12 +16,14 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"path"
 	"testing"
 
-	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/monitoring-mixins/mixtool/pkg/installer"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Try to install every mixin from the mixin repository
@@ -29,14 +31,11 @@ import (
 func TestInstallMixin(t *testing.T) {
 	t.Skip("Test is unreliable as it depends on external mixins.")
 
-	body, err := queryWebsite(defaultWebsite)
+	cache := &registryCache{directory: t.TempDir(), client: http.DefaultClient}
+	mixins, err := readRegistries(defaultRegistryConfig().sorted(), cache)
 	if err != nil {
 		t.Errorf("failed to query website %v", err)
 	}
-	mixins, err := parseMixinJSON(body)
-	if err != nil {
-		t.Errorf("failed to parse mixin body %v", err)
-	}
 
 	// download each mixin in turn
 	for _, m := range mixins {
@@ -47,49 +46,78 @@ func TestInstallMixin(t *testing.T) {
 }
 
 func testInstallMixin(t *testing.T, m mixin) {
-	tmpdir, err := os.CreateTemp("", "mixtool-install")
-	assert.NoError(t, err)
-	defer func() { assert.NoError(t, os.RemoveAll(tmpdir.Name())) }()
-
-	generateCfg := mixer.GenerateOptions{
-		AlertsFilename: "alerts.yaml",
-		RulesFilename:  "rules.yaml",
-		Directory:      "dashboards_out",
-		JPaths:         []string{"vendor"},
-		YAML:           true,
-	}
-
 	mixinURL := path.Join(m.URL, m.Subdir)
 
 	fmt.Printf("installing %v\n", mixinURL)
-	dldir := path.Join(tmpdir.Name(), m.Name+"mixin-test")
-
-	err = os.Mkdir(dldir, 0755)
-	assert.NoError(t, err)
-
-	jsonnetHome := "vendor"
-
-	err = downloadMixin(mixinURL, jsonnetHome, dldir)
-	assert.NoError(t, err)
-
-	_, err = generateMixin(dldir, jsonnetHome, mixinURL, generateCfg)
+	result, err := installer.Install(mixinURL, installer.Options{Directory: t.TempDir()})
 	assert.NoError(t, err)
 
 	// verify that alerts, rules, dashboards exist
-	err = os.Chdir(dldir)
-	assert.NoError(t, err)
+	for _, f := range []string{result.AlertsFile, result.RulesFile, result.DashboardsDirectory} {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			t.Errorf("expected %s", f)
+		}
+	}
+
+	// verify that the output of alerts and rules matches using jsonnet
+}
 
-	if _, err := os.Stat("alerts.yaml"); os.IsNotExist(err) {
-		t.Errorf("expected alerts.yaml in %s", dldir)
+func TestIsGitURL(t *testing.T) {
+	for mixin, expected := range map[string]bool{
+		"kubernetes": false,
+		"https://github.com/example/repo/example-mixin": true,
+		"ssh://git@git.example.com/example/repo.git":    true,
+		"git@git.example.com:example/repo.git/mixin":    true,
+		"github.com/example/repo":                       true,
+	} {
+		assert.Equal(t, expected, isGitURL(mixin), mixin)
 	}
+}
 
-	if _, err := os.Stat("rules.yaml"); os.IsNotExist(err) {
-		t.Errorf("expected rules.yaml in %s", dldir)
+func TestIsLocalPath(t *testing.T) {
+	for mixin, expected := range map[string]bool{
+		"kubernetes":           false,
+		"./kubernetes":         true,
+		"../kubernetes":        true,
+		"/tmp/kubernetes":      true,
+		"kubernetes.tar.gz":    true,
+		"kubernetes-mixin.tgz": true,
+		"mixins/kubernetes":    false,
+		"github.com/kubernetes-monitoring/kubernetes-mixin":         false,
+		"https://example.com/kubernetes-mixin.tar.gz":               false,
+		"git@github.com:kubernetes-monitoring/kubernetes-mixin.tgz": false,
+	} {
+		assert.Equal(t, expected, isLocalPath(mixin), mixin)
 	}
+}
 
-	if _, err := os.Stat("dashboards_out"); os.IsNotExist(err) {
-		t.Errorf("expected dashboards_out in %s", dldir)
+func TestResolveMixin(t *testing.T) {
+	// A directory named like a mixin in the registry, like the install
+	// directory of an earlier install.
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+	require.NoError(t, os.Mkdir("kubernetes", 0755))
+
+	mixins := func() ([]mixin, error) {
+		return []mixin{{Name: "kubernetes", URL: "https://github.com/kubernetes-monitoring/kubernetes-mixin", Version: "v1.0.0"}}, nil
 	}
 
-	// verify that the output of alerts and rules matches using jsonnet
+	source, version, err := resolveMixin("kubernetes", "", mixins)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/kubernetes-monitoring/kubernetes-mixin", source)
+	assert.Equal(t, "v1.0.0", version)
+
+	source, version, err = resolveMixin("./kubernetes", "main", mixins)
+	require.NoError(t, err)
+	assert.Equal(t, "./kubernetes", source)
+	assert.Equal(t, "main", version)
+
+	_, _, err = resolveMixin("unknown", "", mixins)
+	assert.EqualError(t, err, "could not find mixin with name unknown")
+
+	// A missing local path is not mistaken for a git URL.
+	_, _, err = resolveMixin("./missing", "", mixins)
+	assert.EqualError(t, err, "no such directory or tarball ./missing")
 }
@@ -53,6 +53,18 @@ func lintCommand() cli.Command {
 				Name:  "jpath, J",
 				Usage: "Add folders to be used as vendor folders",
 			},
+			cli.BoolFlag{
+				Name:  "runbook-url",
+				Usage: "Require alerts to have a runbook_url annotation with an http or https URL",
+			},
+			cli.StringFlag{
+				Name:  "runbook-url-pattern",
+				Usage: "Go template of a regular expression runbook_url annotations must match, like '#{{ lower .Alert }}$', implies --runbook-url",
+			},
+			cli.StringFlag{
+				Name:  "runbook-dir",
+				Usage: "Directory that must contain a runbook file named after each lowercased alert name, implies --runbook-url",
+			},
 		},
 		Action: lintAction,
 	}
@@ -74,6 +86,10 @@ func lintAction(c *cli.Context) error {
 		JPaths:     jPath,
 		Grafana:    c.BoolT("grafana"),
 		Prometheus: c.BoolT("prometheus"),
+
+		RunbookURL:        c.Bool("runbook-url") || c.String("runbook-url-pattern") != "" || c.String("runbook-dir") != "",
+		RunbookURLPattern: c.String("runbook-url-pattern"),
+		RunbookDirectory:  c.String("runbook-dir"),
 	}
 
 	if err := mixer.Lint(os.Stdout, filename, options); err != nil {
@@ -18,14 +18,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
-	"text/tabwriter"
-	"time"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
 	"github.com/urfave/cli"
+	"golang.org/x/term"
+	"sigs.k8s.io/yaml"
 )
 
 type mixin struct {
@@ -33,6 +35,10 @@ type mixin struct {
 	Description string `json:"description,omitempty"`
 	Name        string `json:"name"`
 	Subdir      string `json:"subdir"`
+	// Version is the recommended version to install, if any.
+	Version string `json:"version,omitempty"`
+	// Registry is the name of the registry the mixin is listed in.
+	Registry string `json:"registry,omitempty"`
 }
 
 const defaultWebsite = "https://monitoring.mixins.dev/mixins.json"
@@ -41,56 +47,141 @@ func listCommand() cli.Command {
 	return cli.Command{
 		Name:        "list",
 		Usage:       "List all available mixins",
-		Description: "List all available mixins as presented on monitoring.mixins.dev",
+		Description: "List all available mixins in the configured registries, by default the ones presented on monitoring.mixins.dev",
 		Action:      listAction,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:  "path, p",
 				Usage: "provide the path of a url with a json endpoint or a local json file",
 			},
-		},
+			cli.StringFlag{
+				Name:  "search, s",
+				Usage: "Only list mixins matching these words in their name or description, forgiving typos",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Output format, one of table, json or yaml",
+				Value: "table",
+			},
+		}, registryFlags...),
 	}
 }
 
-func queryWebsite(mixinsWebsite string) ([]byte, error) {
-	client := http.Client{
-		Timeout: time.Second * 10,
+// printMixins writes the mixins as a table. The descriptions are shortened
+// to fit the table into width, unless width is 0.
+func printMixins(w io.Writer, mixinsList []mixin, width int) error {
+	rows := make([][]string, 0, len(mixinsList))
+	for _, m := range mixinsList {
+		description := strings.Join(strings.Fields(m.Description), " ")
+		if description == "" {
+			description = "N/A"
+		}
+		rows = append(rows, []string{m.Name, description, m.URL, m.Subdir})
 	}
+	header := []string{"NAME", "DESCRIPTION", "SOURCE", "SUBDIR"}
 
-	req, err := http.NewRequest(http.MethodGet, mixinsWebsite, nil)
-	if err != nil {
-		return nil, err
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
 	}
 
-	req.Header.Set("User-Agent", "mixtool-list")
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	// The description column takes the space left by the other columns.
+	const padding = 2
+	if width > 0 {
+		others := padding * (len(widths) - 1)
+		for i, w := range widths {
+			if i != 1 {
+				others += w
+			}
+		}
+		widths[1] = max(min(widths[1], width-others), len("DESCRIPTION"))
 	}
-	defer func() { _ = res.Body.Close() }()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+
+	writeRow := func(row []string, colorize func(string, ...interface{}) string) error {
+		var b strings.Builder
+		for i, cell := range row {
+			cell = truncate(cell, widths[i])
+			if i < len(row)-1 {
+				cell += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+padding)
+			}
+			if i == 0 {
+				cell = colorize("%s", cell)
+			}
+			b.WriteString(cell)
+		}
+		_, err := fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+		return err
 	}
 
-	return body, nil
+	if err := writeRow(header, fmt.Sprintf); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writeRow(row, color.GreenString); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func printMixins(mixinsList []mixin) error {
-	writer := tabwriter.NewWriter(os.Stdout, 4, 8, 0, '\t', tabwriter.TabIndent)
-	_, _ = fmt.Fprintln(writer, "name")
-	_, _ = fmt.Fprintln(writer, "----")
-	for _, m := range mixinsList {
-		// for now, do not print out any of the descriptions
-		// m.Description = strings.Replace(m.Description, "\n", "", -1)
-		// // maybe truncate the description if it's too long
-		// if len(m.Description) <= 0 {
-		// 	m.Description = "N/A"
-		// }
-		_, _ = fmt.Fprintf(writer, "%s\n", color.GreenString(m.Name))
+// truncate shortens s to width characters, ending it with an ellipsis.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	if width < 1 {
+		return ""
 	}
+	return string(runes[:width-1]) + "…"
+}
 
-	return writer.Flush()
+// terminalWidth returns the width of the terminal stdout is written to,
+// or 0 if it is not a terminal. COLUMNS takes precedence if set.
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return 0
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// writeMixins writes the mixins in the given output format.
+func writeMixins(w io.Writer, mixins []mixin, output string) error {
+	if mixins == nil {
+		mixins = []mixin{}
+	}
+	// Structured output has the format of a registry.
+	registry := map[string][]mixin{"mixins": mixins}
+
+	switch output {
+	case "", "table":
+		return printMixins(w, mixins, terminalWidth())
+	case "json":
+		out, err := json.MarshalIndent(registry, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "yaml":
+		out, err := yaml.Marshal(registry)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q, expected table, json or yaml", output)
 }
 
 // ParsesMixinJSON expects a top level key mixins which contains a list of mixins
@@ -103,52 +194,42 @@ func parseMixinJSON(body []byte) ([]mixin, error) {
 	return mixinsList, nil
 }
 
-// if path is not specified, default to the mixins website
+// readRegistry returns the mixins of the registry at location, either a
+// URL queried through cache or a local JSON file.
+func readRegistry(location string, cache *registryCache) ([]mixin, error) {
+	var body []byte
+	var err error
+	if u, perr := url.ParseRequestURI(location); perr == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		body, err = cache.get(location)
+	} else {
+		body, err = os.ReadFile(location)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseMixinJSON(body)
+}
+
+// if path is not specified, list the mixins of the configured registries
 // otherwise, try parse as url
 // otherwise, try look for a local json file
 func listAction(c *cli.Context) error {
 	path := c.String("path")
-	var body []byte
-	var err error
 	if path == "" {
-		body, err = queryWebsite(defaultWebsite)
+		mixins, err := getMixins(c)
 		if err != nil {
 			return err
 		}
-		mixins, err := parseMixinJSON(body)
-		if err != nil {
-			return err
-		}
-		return printMixins(mixins)
+		return writeMixins(os.Stdout, searchMixins(mixins, c.String("search")), c.String("output"))
 	}
 
-	_, err = url.ParseRequestURI(path)
-	if err != nil {
-		// check if it's a local json file
-		_, err = os.Stat(path)
-		if err != nil {
-			return err
-		}
-		body, err = os.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		mixins, err := parseMixinJSON(body)
-		if err != nil {
-			return err
-		}
-		return printMixins(mixins)
-	}
-
-	body, err = queryWebsite(path)
+	cache, err := newRegistryCache(c)
 	if err != nil {
 		return err
 	}
-
-	mixins, err := parseMixinJSON(body)
+	mixins, err := readRegistry(path, cache)
 	if err != nil {
 		return err
 	}
-
-	return printMixins(mixins)
+	return writeMixins(os.Stdout, searchMixins(mixins, c.String("search")), c.String("output"))
 }
@@ -0,0 +1,171 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// searchMixins returns the mixins matching every word of query, the best
+// matches first. Words are matched fuzzily against the name, and against
+// the single words of the description, so that typos are forgiven.
+func searchMixins(mixins []mixin, query string) []mixin {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return mixins
+	}
+
+	type result struct {
+		mixin mixin
+		score int
+	}
+	var results []result
+	for _, m := range mixins {
+		total := 0
+		for _, term := range terms {
+			score, ok := matchMixin(m, term)
+			if !ok {
+				total = -1
+				break
+			}
+			total += score
+		}
+		if total >= 0 {
+			results = append(results, result{mixin: m, score: total})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].mixin.Name < results[j].mixin.Name
+	})
+
+	matches := make([]mixin, 0, len(results))
+	for _, r := range results {
+		matches = append(matches, r.mixin)
+	}
+	return matches
+}
+
+// matchMixin returns how well term matches the mixin. Matches in the name
+// count twice as much as the ones in the description.
+func matchMixin(m mixin, term string) (int, bool) {
+	best, found := 0, false
+	if score, ok := fuzzyScore(term, m.Name); ok {
+		best, found = 2*score, true
+	}
+	for _, word := range strings.Fields(m.Description) {
+		if score, ok := fuzzyScore(term, word); ok && (!found || score > best) {
+			best, found = score, true
+		}
+	}
+	return best, found
+}
+
+// fuzzyScore returns how well query matches text, ignoring case, and
+// whether it matches at all. Text contains query as a substring, is within
+// a few typos of it, or contains at least its characters in order.
+// Prefixes score higher than substrings, which score higher than typos,
+// which score higher than scattered characters.
+func fuzzyScore(query, text string) (int, bool) {
+	query, text = strings.ToLower(query), strings.ToLower(text)
+	q := []rune(query)
+
+	if i := strings.Index(text, query); i >= 0 {
+		score := 10 * len(q)
+		if i == 0 {
+			score += 5
+		}
+		return score, true
+	}
+
+	if maxTypos := allowedTypos(len(q)); maxTypos > 0 {
+		if d, ok := typoDistance(q, []rune(text), maxTypos); ok {
+			return 10 * (len(q) - d), true
+		}
+	}
+
+	score, matched, prev := 0, 0, -2
+	for i, r := range []rune(text) {
+		if matched == len(q) {
+			break
+		}
+		if r != q[matched] {
+			continue
+		}
+		score++
+		if i == prev+1 {
+			score += 2
+		}
+		prev = i
+		matched++
+	}
+	return score, matched == len(q)
+}
+
+// allowedTypos returns how many typos a query of n runes may contain. Short
+// queries have to be typed exactly, as a single typo already turns them
+// into a different word.
+func allowedTypos(n int) int {
+	switch {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// typoDistance returns the Damerau-Levenshtein distance of a and b, counting
+// insertions, deletions, substitutions and transpositions of adjacent
+// runes, and whether it is at most limit.
+func typoDistance(a, b []rune, limit int) (int, bool) {
+	if diff := len(a) - len(b); diff > limit || -diff > limit {
+		return 0, false
+	}
+
+	// Only the last three rows of the matrix are needed.
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d = min(d, prev2[j-2]+1)
+			}
+			curr[j] = d
+			rowMin = min(rowMin, d)
+		}
+		if rowMin > limit {
+			return 0, false
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)], prev[len(b)] <= limit
+}
@@ -15,10 +15,14 @@
 package main
 
 import (
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
 )
 
 const exampleMixins = `
@@ -66,3 +70,98 @@ func TestList(t *testing.T) {
 		}
 	}
 }
+
+func TestSearchMixins(t *testing.T) {
+	mixins, err := parseMixinJSON([]byte(exampleMixins))
+	assert.NoError(t, err)
+
+	names := func(mixins []mixin) []string {
+		var names []string
+		for _, m := range mixins {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"ceph", "cortex", "cool-mixin"}, names(searchMixins(mixins, "")))
+	assert.Equal(t, []string{"cortex"}, names(searchMixins(mixins, "cortex")))
+	// Typos are forgiven.
+	assert.Equal(t, []string{"cortex"}, names(searchMixins(mixins, "crtex")))
+	assert.Equal(t, []string{"cortex"}, names(searchMixins(mixins, "cotrex")))
+	assert.Equal(t, []string{"ceph"}, names(searchMixins(mixins, "promethaus")))
+	assert.Empty(t, searchMixins(mixins, "cxrtxx"))
+	// Names rank above descriptions.
+	assert.Equal(t, []string{"cool-mixin", "cortex", "ceph"}, names(searchMixins(mixins, "co")))
+	// Descriptions are searched, and every word has to match.
+	assert.Equal(t, []string{"cool-mixin"}, names(searchMixins(mixins, "fantastic")))
+	assert.Equal(t, []string{"ceph"}, names(searchMixins(mixins, "prometheus ceph")))
+	assert.Empty(t, searchMixins(mixins, "ceph fantastic"))
+}
+
+func TestFuzzyScore(t *testing.T) {
+	for _, tc := range []struct {
+		query, text string
+		matches     bool
+	}{
+		{"kube", "kubernetes", true},
+		{"kuberentes", "kubernetes", true},
+		{"kubernetis", "Kubernetes", true},
+		{"kubernetis", "kubernetes-mixin", false},
+		{"kubrenetis", "kubernetes", true},
+		{"kubrenetiz", "kubernetes", false},
+		{"cpeh", "ceph", true},
+		{"cepf", "ceph", true},
+		{"cpfh", "ceph", false},
+		{"cpe", "ceph", false},
+	} {
+		_, ok := fuzzyScore(tc.query, tc.text)
+		assert.Equal(t, tc.matches, ok, "%s in %s", tc.query, tc.text)
+	}
+
+	// Typos score lower than substrings.
+	exact, _ := fuzzyScore("kubernetes", "kubernetes")
+	typo, _ := fuzzyScore("kuberentes", "kubernetes")
+	assert.Less(t, typo, exact)
+}
+
+func TestPrintMixins(t *testing.T) {
+	mixins, err := parseMixinJSON([]byte(exampleMixins))
+	assert.NoError(t, err)
+
+	var b strings.Builder
+	assert.NoError(t, printMixins(&b, mixins, 0))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[0], "NAME"))
+	assert.Contains(t, lines[1], "A set of Prometheus alerts for Ceph. The scope")
+	assert.Contains(t, lines[2], "N/A")
+
+	b.Reset()
+	assert.NoError(t, printMixins(&b, mixins, 100))
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		assert.LessOrEqual(t, utf8.RuneCountInString(line), 100, line)
+	}
+	assert.Contains(t, b.String(), "…")
+}
+
+func TestWriteMixins(t *testing.T) {
+	mixins, err := parseMixinJSON([]byte(exampleMixins))
+	assert.NoError(t, err)
+
+	for _, output := range []string{"json", "yaml"} {
+		var b strings.Builder
+		assert.NoError(t, writeMixins(&b, mixins, output))
+
+		// The output is a registry itself.
+		content := []byte(b.String())
+		if output == "yaml" {
+			content, err = yaml.YAMLToJSON(content)
+			assert.NoError(t, err)
+		}
+		parsed, err := parseMixinJSON(content)
+		assert.NoError(t, err)
+		assert.Equal(t, mixins, parsed, output)
+	}
+
+	assert.Error(t, writeMixins(io.Discard, mixins, "xml"))
+}
@@ -41,6 +41,10 @@ func main() {
 		serverCommand(),
 		listCommand(),
 		installCommand(),
+		upgradeCommand(),
+		uninstallCommand(),
+		infoCommand(),
+		importCommand(),
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -15,11 +15,16 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/monitoring-mixins/mixtool/pkg/jsonnetbundler"
 	"github.com/monitoring-mixins/mixtool/pkg/mixer"
 	"github.com/urfave/cli"
+	"golang.org/x/term"
 )
 
 func newCommand() cli.Command {
@@ -32,22 +37,82 @@ func newCommand() cli.Command {
 				Name:   "grafana-dashboard",
 				Usage:  "Create a new file with a Grafana dashboard mixin inside",
 				Action: newGrafanaDashboard,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "template, t",
+						Usage: "Template of the dashboard, see --list-templates",
+						Value: mixer.DefaultDashboardTemplate,
+					},
+					cli.StringFlag{
+						Name:  "template-dir",
+						Usage: "Directory with additional dashboard templates, defaults to mixtool/templates/dashboards in the user config directory",
+					},
+					cli.BoolFlag{
+						Name:  "list-templates",
+						Usage: "List the available dashboard templates",
+					},
+					cli.StringFlag{
+						Name:  "title",
+						Usage: "Title of the dashboard, defaults to its file name",
+					},
+					cli.StringFlag{
+						Name:  "uid",
+						Usage: "UID of the dashboard, defaults to its file name",
+					},
+				},
 			},
 			cli.Command{
-				Name:   "prometheus-alerts",
-				Usage:  "Create a new file with Prometheus alert mixins inside",
-				Action: newPrometheusAlerts,
+				Name:        "prometheus-alerts",
+				Usage:       "Create a new file with Prometheus alert mixins inside, or add an alert to one",
+				Description: "Add an alert given by flags, prompting for the missing ones in a terminal, to a new or existing file. Without a terminal or flags, a file with an example alert is created",
+				ArgsUsage:   "<filename>",
+				Action:      newPrometheusAlerts,
+				Flags:       alertFlags,
 			},
 			cli.Command{
 				Name:   "prometheus-rules",
 				Usage:  "Create a new file with Prometheus rule mixins inside",
 				Action: newPrometheusRules,
 			},
+			cli.Command{
+				Name:      "mixin",
+				Usage:     "Create a new mixin project with alerts, rules, a dashboard, tests and a Makefile",
+				ArgsUsage: "<directory>",
+				Action:    newMixin,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "name",
+						Usage: "Name of the mixin, defaults to the name of the directory",
+					},
+					cli.BoolFlag{
+						Name:  "skip-install",
+						Usage: "Don't install the dependencies of the mixin with jsonnet-bundler",
+					},
+				},
+			},
 		},
 	}
 }
 
 func newGrafanaDashboard(c *cli.Context) error {
+	templateDir := c.String("template-dir")
+	if templateDir == "" {
+		if configDir, err := os.UserConfigDir(); err == nil {
+			templateDir = filepath.Join(configDir, "mixtool", "templates", "dashboards")
+		}
+	}
+
+	if c.Bool("list-templates") {
+		templates, err := mixer.DashboardTemplates(templateDir)
+		if err != nil {
+			return err
+		}
+		for _, t := range templates {
+			fmt.Println(t)
+		}
+		return nil
+	}
+
 	if len(c.Args()) != 1 {
 		return fmt.Errorf("expected filename as only argument")
 	}
@@ -57,7 +122,30 @@ func newGrafanaDashboard(c *cli.Context) error {
 		return fmt.Errorf("file already exists. not overwriting")
 	}
 
-	return writeFileToDisk(filename, mixer.NewGrafanaDashboard)
+	opts := mixer.DashboardOptions{
+		Template:          c.String("template"),
+		TemplateDirectory: templateDir,
+		Name:              dashboardName(filename),
+		Title:             c.String("title"),
+		UID:               c.String("uid"),
+	}
+	// Create the dashboard before the file, so that it is not left empty
+	// if the template fails.
+	out, err := mixer.NewGrafanaDashboard(opts)
+	if err != nil {
+		return err
+	}
+	return writeFileToDisk(filename, func() ([]byte, error) { return out, nil })
+}
+
+// dashboardName returns the name of the dashboard in filename, which is
+// its base name without the jsonnet extension.
+func dashboardName(filename string) string {
+	name := filepath.Base(filename)
+	for _, ext := range []string{".libsonnet", ".jsonnet"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
 }
 
 func newPrometheusAlerts(c *cli.Context) error {
@@ -66,11 +154,26 @@ func newPrometheusAlerts(c *cli.Context) error {
 	}
 
 	filename := c.Args().First()
-	if fileExists(filename) {
-		return fmt.Errorf("file already exists. not overwriting")
+	values := map[string]string{}
+	for _, f := range alertFields {
+		if c.IsSet(f.flag) {
+			values[f.flag] = c.String(f.flag)
+		}
+	}
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+
+	if len(values) == 0 && !interactive {
+		if fileExists(filename) {
+			return fmt.Errorf("file already exists. not overwriting")
+		}
+		return writeFileToDisk(filename, mixer.NewPrometheusAlerts)
 	}
 
-	return writeFileToDisk(filename, mixer.NewPrometheusAlerts)
+	var p *prompter
+	if interactive {
+		p = &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+	}
+	return addPrometheusAlert(os.Stdout, filename, values, p)
 }
 
 func newPrometheusRules(c *cli.Context) error {
@@ -86,6 +189,54 @@ func newPrometheusRules(c *cli.Context) error {
 	return writeFileToDisk(filename, mixer.NewPrometheusRules)
 }
 
+func newMixin(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("expected directory as only argument")
+	}
+
+	dir := c.Args().First()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("directory %s is not empty. not overwriting", dir)
+	}
+
+	name := c.String("name")
+	if name == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		name = filepath.Base(abs)
+	}
+
+	files, err := mixer.NewMixin(name)
+	if err != nil {
+		return err
+	}
+
+	for filename, content := range files {
+		filename = filepath.Join(dir, filename)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, content, 0644); err != nil {
+			return fmt.Errorf("failed to create file %s: %v", filename, err)
+		}
+	}
+
+	if !c.Bool("skip-install") {
+		if err := jsonnetbundler.InstallCommand(dir, "vendor", nil, false); err != nil {
+			return fmt.Errorf("created mixin %s in %s, but failed to install its dependencies, run jb install there: %w", name, dir, err)
+		}
+	}
+
+	fmt.Printf("Created mixin %s in %s, run make there to lint, test and generate it\n", name, dir)
+	return nil
+}
+
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
 	if os.IsNotExist(err) {
@@ -0,0 +1,157 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/urfave/cli"
+)
+
+// alertFields are the flags of an alert, in the order they are prompted for.
+var alertFields = []struct {
+	flag     string
+	prompt   string
+	usage    string
+	required bool
+}{
+	{"group", "Group", "Group of the alert, defaults to the first group of the file or its name", false},
+	{"name", "Name, in CamelCase", "Name of the alert, in CamelCase", true},
+	{"expr", "Expression", "PromQL expression of the alert", true},
+	{"for", "For", "Duration the expression has to be true for before the alert fires (default: 5m)", false},
+	{"severity", "Severity, one of critical, warning or info", "Severity of the alert, one of critical, warning or info (default: warning)", false},
+	{"summary", "Summary, a sentence without templates", "Summary of the alert, a sentence without templates", true},
+	{"description", "Description, using templates like {{ $labels.instance }}", "Description of the alert, using templates like {{ $labels.instance }}", true},
+}
+
+var alertFlags = func() []cli.Flag {
+	flags := make([]cli.Flag, 0, len(alertFields))
+	for _, f := range alertFields {
+		flags = append(flags, cli.StringFlag{Name: f.flag, Usage: f.usage})
+	}
+	return flags
+}()
+
+// prompter asks for values on a terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prompts for a value, returning def if the answer is empty.
+func (p *prompter) ask(prompt, def string) (string, error) {
+	if def != "" {
+		prompt = fmt.Sprintf("%s [%s]", prompt, def)
+	}
+	if _, err := fmt.Fprintf(p.out, "%s: ", prompt); err != nil {
+		return "", err
+	}
+	answer, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// readAlert returns the alert of the given flag values. Missing values are
+// asked for with p, or taken from the defaults if p is nil.
+func readAlert(values, defaults map[string]string, p *prompter) (mixer.Alert, error) {
+	var missing []string
+	for _, f := range alertFields {
+		if _, ok := values[f.flag]; ok {
+			continue
+		}
+		if p == nil {
+			if f.required {
+				missing = append(missing, "--"+f.flag)
+			}
+			values[f.flag] = defaults[f.flag]
+			continue
+		}
+		value, err := p.ask(f.prompt, defaults[f.flag])
+		if err != nil {
+			return mixer.Alert{}, err
+		}
+		values[f.flag] = value
+	}
+	if len(missing) > 0 {
+		return mixer.Alert{}, fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	return mixer.Alert{
+		Group:       values["group"],
+		Name:        values["name"],
+		Expr:        values["expr"],
+		For:         values["for"],
+		Severity:    values["severity"],
+		Summary:     values["summary"],
+		Description: values["description"],
+	}, nil
+}
+
+// addPrometheusAlert adds the alert given by values and p to filename,
+// creating it if it does not exist, if the alert is valid.
+func addPrometheusAlert(w io.Writer, filename string, values map[string]string, p *prompter) error {
+	content, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	groups, err := mixer.AlertGroupNames(filename, content)
+	if err != nil {
+		return err
+	}
+	defaults := map[string]string{
+		"for":      "5m",
+		"severity": "warning",
+	}
+	if len(groups) > 0 {
+		defaults["group"] = groups[0]
+	} else {
+		defaults["group"] = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+
+	alert, err := readAlert(values, defaults, p)
+	if err != nil {
+		return err
+	}
+	if errs := mixer.ValidateAlert(alert, filepath.Dir(filename)); len(errs) > 0 {
+		for _, err := range errs {
+			_, _ = fmt.Fprintln(w, color.RedString(err.Error()))
+		}
+		return fmt.Errorf("alert %s is invalid, not writing it", alert.Name)
+	}
+
+	out, err := mixer.AddPrometheusAlert(filename, content, alert)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename, out, 0644); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Added alert %s to group %s in %s\n", alert.Name, alert.Group, filename)
+	return err
+}
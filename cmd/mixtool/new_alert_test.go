@@ -0,0 +1,92 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAlert(t *testing.T) {
+	// Empty answers take the defaults.
+	input := "\nExampleDown\nup == 0\n\ncritical\nExample is down.\n{{ $labels.instance }} is down."
+	var out strings.Builder
+	p := &prompter{in: bufio.NewReader(strings.NewReader(input)), out: &out}
+
+	alert, err := readAlert(map[string]string{}, map[string]string{"group": "example", "for": "5m"}, p)
+	require.NoError(t, err)
+	assert.Equal(t, mixer.Alert{
+		Group:       "example",
+		Name:        "ExampleDown",
+		Expr:        "up == 0",
+		For:         "5m",
+		Severity:    "critical",
+		Summary:     "Example is down.",
+		Description: "{{ $labels.instance }} is down.",
+	}, alert)
+	assert.Contains(t, out.String(), "Group [example]: ")
+
+	_, err = readAlert(map[string]string{"name": "ExampleDown"}, map[string]string{}, nil)
+	assert.EqualError(t, err, "missing --expr, --summary, --description")
+}
+
+func TestAddPrometheusAlert(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "alerts.libsonnet")
+	values := func(name string) map[string]string {
+		return map[string]string{
+			"name":        name,
+			"expr":        "up == 0",
+			"summary":     "Example is down.",
+			"description": "{{ $labels.instance }} is down.",
+		}
+	}
+
+	var out strings.Builder
+	require.NoError(t, addPrometheusAlert(&out, filename, values("ExampleDown"), nil))
+	assert.Equal(t, "Added alert ExampleDown to group alerts in "+filename+"\n", out.String())
+
+	// Alerts are added to the first group of an existing file.
+	out.Reset()
+	require.NoError(t, addPrometheusAlert(&out, filename, values("ExampleUnreachable"), nil))
+	assert.Equal(t, "Added alert ExampleUnreachable to group alerts in "+filename+"\n", out.String())
+
+	info, err := mixer.Describe(filename, mixer.GenerateOptions{})
+	require.NoError(t, err)
+	require.Len(t, info.AlertGroups, 1)
+	assert.Equal(t, []mixer.AlertInfo{
+		{Name: "ExampleDown", Severity: "warning"},
+		{Name: "ExampleUnreachable", Severity: "warning"},
+	}, info.AlertGroups[0].Alerts)
+
+	// Invalid alerts are not written.
+	before, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	out.Reset()
+	invalid := values("example_down")
+	invalid["severity"] = "page"
+	assert.Error(t, addPrometheusAlert(&out, filename, invalid, nil))
+	assert.Contains(t, out.String(), "[alert-name-camelcase]")
+	assert.Contains(t, out.String(), "[alert-severity-rule]")
+	after, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+const defaultRegistryName = "monitoring.mixins.dev"
+
+// registryFlags are the flags of the commands reading the registries.
+var registryFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "registry-config",
+		Usage: "File listing the registries to use, defaults to mixtool/registries.yaml in the user config directory",
+	},
+	cli.BoolFlag{
+		Name:  "offline",
+		Usage: "Only use the cached registries, without querying them",
+	},
+	cli.DurationFlag{
+		Name:  "cache-ttl",
+		Usage: "Duration the cached registries are used for before they are revalidated",
+		Value: defaultRegistryCacheTTL,
+	},
+}
+
+// registryConfig lists the registries mixins are listed and installed from.
+type registryConfig struct {
+	Registries []registry `yaml:"registries"`
+}
+
+// registry is a JSON list of mixins, served over HTTP or in a local file.
+// Mixins in registries with a higher priority take precedence over the
+// ones with the same name in registries with a lower priority.
+type registry struct {
+	Name     string `yaml:"name"`
+	URL      string `yaml:"url"`
+	File     string `yaml:"file"`
+	Priority int    `yaml:"priority"`
+}
+
+func defaultRegistryConfig() *registryConfig {
+	return &registryConfig{
+		Registries: []registry{{Name: defaultRegistryName, URL: defaultWebsite}},
+	}
+}
+
+// loadRegistryConfig reads the registries from filename. Without a
+// filename, the file in the user config directory is read if it exists,
+// otherwise the public registry is used.
+func loadRegistryConfig(filename string) (*registryConfig, error) {
+	if filename == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return defaultRegistryConfig(), nil
+		}
+		filename = filepath.Join(dir, "mixtool", "registries.yaml")
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return defaultRegistryConfig(), nil
+		}
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registry config file: %w", err)
+	}
+
+	var cfg registryConfig
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse registry config file %s: %w", filename, err)
+	}
+	for i := range cfg.Registries {
+		cfg.Registries[i].File = joinDir(filepath.Dir(filename), cfg.Registries[i].File)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid registry config file %s: %w", filename, err)
+	}
+	return &cfg, nil
+}
+
+func (c *registryConfig) validate() error {
+	if len(c.Registries) == 0 {
+		return fmt.Errorf("no registries configured")
+	}
+
+	names := map[string]bool{}
+	for _, r := range c.Registries {
+		if r.Name == "" {
+			return fmt.Errorf("registries need a name")
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate registry %s", r.Name)
+		}
+		names[r.Name] = true
+
+		if (r.URL == "") == (r.File == "") {
+			return fmt.Errorf("registry %s needs either a url or a file", r.Name)
+		}
+		if r.URL != "" {
+			u, err := url.Parse(r.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("registry %s has an invalid url %q", r.Name, r.URL)
+			}
+		}
+	}
+	return nil
+}
+
+// sorted returns the registries by descending priority, keeping the order
+// of the file for registries of the same priority.
+func (c *registryConfig) sorted() []registry {
+	registries := append([]registry(nil), c.Registries...)
+	sort.SliceStable(registries, func(i, j int) bool {
+		return registries[i].Priority > registries[j].Priority
+	})
+	return registries
+}
+
+func (r registry) location() string {
+	if r.URL != "" {
+		return r.URL
+	}
+	return r.File
+}
+
+// readRegistries returns the mixins of all registries, which must be
+// sorted by priority. A mixin is only returned from the registry with the
+// highest priority that has it. All registries need to be read, so that an
+// unavailable registry cannot change which mixin a name refers to.
+func readRegistries(registries []registry, cache *registryCache) ([]mixin, error) {
+	var mixins []mixin
+	seen := map[string]bool{}
+	for _, r := range registries {
+		list, err := readRegistry(r.location(), cache)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read registry %s: %w", r.Name, err)
+		}
+		for _, m := range list {
+			if seen[m.Name] {
+				continue
+			}
+			seen[m.Name] = true
+			m.Registry = r.Name
+			mixins = append(mixins, m)
+		}
+	}
+	return mixins, nil
+}
+
+// getMixins returns the mixins of the registries configured for c.
+func getMixins(c *cli.Context) ([]mixin, error) {
+	cfg, err := loadRegistryConfig(c.String("registry-config"))
+	if err != nil {
+		return nil, err
+	}
+	cache, err := newRegistryCache(c)
+	if err != nil {
+		return nil, err
+	}
+	return readRegistries(cfg.sorted(), cache)
+}
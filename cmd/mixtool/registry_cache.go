@@ -0,0 +1,167 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const defaultRegistryCacheTTL = time.Hour
+
+// registryCacheEntry is a cached response of a registry.
+type registryCacheEntry struct {
+	URL     string    `json:"url"`
+	ETag    string    `json:"etag,omitempty"`
+	Fetched time.Time `json:"fetched"`
+	Body    []byte    `json:"body"`
+}
+
+// registryCache stores the responses of registries in a directory. Once
+// they are older than ttl, they are revalidated with their ETag.
+type registryCache struct {
+	directory string
+	ttl       time.Duration
+	offline   bool
+	client    *http.Client
+}
+
+func newRegistryCache(c *cli.Context) (*registryCache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the cache directory: %w", err)
+	}
+	return &registryCache{
+		directory: filepath.Join(dir, "mixtool", "registry"),
+		ttl:       c.Duration("cache-ttl"),
+		offline:   c.Bool("offline"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// get returns the response of the registry at url, from the cache if it
+// is fresh or still valid. If the registry cannot be reached, a stale
+// response is used. A cache that cannot be read or written only warns, it
+// fails when there is neither a response nor a cached one.
+func (c *registryCache) get(url string) ([]byte, error) {
+	entry, err := c.load(url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read cached registry %s: %v\n", url, err)
+	}
+
+	if c.offline {
+		if entry == nil {
+			return nil, fmt.Errorf("registry %s is not cached, run without --offline first", url)
+		}
+		return entry.Body, nil
+	}
+	if entry != nil && time.Since(entry.Fetched) < c.ttl {
+		return entry.Body, nil
+	}
+
+	fetched, err := c.fetch(url, entry)
+	if err != nil {
+		if entry == nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Using cached registry %s from %s: %v\n", url, entry.Fetched.Format(time.RFC3339), err)
+		return entry.Body, nil
+	}
+	if err := c.store(fetched); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to cache registry %s: %v\n", url, err)
+	}
+	return fetched.Body, nil
+}
+
+// fetch queries the registry at url, revalidating entry if given.
+func (c *registryCache) fetch(url string, entry *registryCacheEntry) (*registryCacheEntry, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "mixtool-list")
+	if entry != nil && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	switch {
+	case res.StatusCode == http.StatusNotModified && entry != nil:
+		revalidated := *entry
+		revalidated.Fetched = time.Now()
+		return &revalidated, nil
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("non 200 response code from %s: %d", url, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &registryCacheEntry{
+		URL:     url,
+		ETag:    res.Header.Get("ETag"),
+		Fetched: time.Now(),
+		Body:    body,
+	}, nil
+}
+
+// load returns the cached entry of url, or nil if there is none.
+func (c *registryCache) load(url string) (*registryCacheEntry, error) {
+	content, err := os.ReadFile(c.filename(url))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry registryCacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil || entry.URL != url {
+		// A corrupt entry is replaced by the next response.
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (c *registryCache) store(entry *registryCacheEntry) error {
+	if err := os.MkdirAll(c.directory, 0755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.filename(entry.URL), content)
+}
+
+func (c *registryCache) filename(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.directory, hex.EncodeToString(sum[:8])+".json")
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryCache(t *testing.T) {
+	var requests, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(exampleMixins))
+	}))
+	defer ts.Close()
+
+	cache := &registryCache{directory: t.TempDir(), ttl: time.Hour, client: ts.Client()}
+
+	// Offline, nothing is cached yet.
+	cache.offline = true
+	_, err := cache.get(ts.URL)
+	assert.Error(t, err)
+	assert.Equal(t, 0, requests)
+
+	cache.offline = false
+	mixins, err := readRegistry(ts.URL, cache)
+	require.NoError(t, err)
+	assert.Len(t, mixins, 3)
+	assert.Equal(t, 1, requests)
+
+	// A fresh response is served from the cache.
+	_, err = cache.get(ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	// An expired response is revalidated with its ETag.
+	cache.ttl = 0
+	body, err := cache.get(ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, exampleMixins, string(body))
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, notModified)
+
+	// Offline, the cached response is used regardless of its age.
+	cache.offline = true
+	body, err = cache.get(ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, exampleMixins, string(body))
+	assert.Equal(t, 2, requests)
+
+	// A registry that cannot be reached falls back to the cache.
+	cache.offline = false
+	ts.Close()
+	body, err = cache.get(ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, exampleMixins, string(body))
+}
+
+func TestRegistryCacheUnwritable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(exampleMixins))
+	}))
+	defer ts.Close()
+
+	// The cache directory cannot be created below a file.
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	cache := &registryCache{directory: filepath.Join(file, "registry"), ttl: time.Hour, client: ts.Client()}
+
+	// The fetched response is used nonetheless.
+	body, err := cache.get(ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, exampleMixins, string(body))
+
+	// Without a response nor a cached one, it fails.
+	ts.Close()
+	_, err = cache.get(ts.URL)
+	assert.Error(t, err)
+}
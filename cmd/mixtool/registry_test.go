@@ -0,0 +1,98 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const internalMixins = `
+{
+    "mixins": [
+        {
+            "name": "ceph",
+            "source": "https://git.example.com/mixins/ceph-mixin",
+            "subdir": ""
+        },
+        {
+            "name": "internal",
+            "source": "https://git.example.com/mixins/internal-mixin",
+            "subdir": ""
+        }
+    ]
+}
+`
+
+func TestRegistries(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "public.json"), []byte(exampleMixins), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "internal.json"), []byte(internalMixins), 0644))
+
+	filename := filepath.Join(dir, "registries.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(`
+registries:
+- name: public
+  file: public.json
+- name: internal
+  file: internal.json
+  priority: 10
+`), 0644))
+
+	cfg, err := loadRegistryConfig(filename)
+	require.NoError(t, err)
+
+	registries := cfg.sorted()
+	assert.Equal(t, "internal", registries[0].Name)
+	assert.Equal(t, filepath.Join(dir, "internal.json"), registries[0].File)
+
+	mixins, err := readRegistries(registries, &registryCache{directory: t.TempDir()})
+	require.NoError(t, err)
+
+	sources := map[string]string{}
+	for _, m := range mixins {
+		sources[m.Name] = m.Registry + " " + m.URL
+	}
+	assert.Equal(t, map[string]string{
+		"ceph":       "internal https://git.example.com/mixins/ceph-mixin",
+		"internal":   "internal https://git.example.com/mixins/internal-mixin",
+		"cortex":     "public https://github.com/grafana/cortex-jsonnet",
+		"cool-mixin": "public https://github.com",
+	}, sources)
+
+	// An unavailable registry fails the lookup instead of falling back to
+	// mixins of the same name in other registries.
+	require.NoError(t, os.Remove(filepath.Join(dir, "internal.json")))
+	_, err = readRegistries(registries, &registryCache{directory: t.TempDir()})
+	assert.Error(t, err)
+}
+
+func TestRegistryConfigValidate(t *testing.T) {
+	for name, cfg := range map[string]registryConfig{
+		"empty":     {},
+		"no name":   {Registries: []registry{{URL: "https://example.com/mixins.json"}}},
+		"duplicate": {Registries: []registry{{Name: "a", File: "a.json"}, {Name: "a", File: "b.json"}}},
+		"no source": {Registries: []registry{{Name: "a"}}},
+		"both":      {Registries: []registry{{Name: "a", URL: "https://example.com/mixins.json", File: "a.json"}}},
+		"bad url":   {Registries: []registry{{Name: "a", URL: "ftp://example.com/mixins.json"}}},
+	} {
+		assert.Error(t, cfg.validate(), name)
+	}
+	assert.NoError(t, defaultRegistryConfig().validate())
+}
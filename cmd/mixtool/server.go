@@ -15,16 +15,24 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
 )
 
 func serverCommand() cli.Command {
@@ -37,158 +45,422 @@ func serverCommand() cli.Command {
 				Name:  "bind-address",
 				Usage: "Address to bind HTTP server to.",
 			},
-			cli.StringFlag{
+			cli.StringSliceFlag{
 				Name:  "prometheus-reload-url",
-				Value: "http://127.0.0.1:9090/-/reload",
-				Usage: "Prometheus address to reload after provisioning the rule file(s).",
+				Usage: "Prometheus address to reload after provisioning the rule file(s). Can be repeated. Defaults to " + defaultPrometheusReloadURL + " if no other reload target is given.",
+			},
+			cli.StringSliceFlag{
+				Name:  "thanos-ruler-reload-url",
+				Usage: "Thanos Ruler address to reload after provisioning the rule file(s). Can be repeated.",
 			},
 			cli.StringFlag{
 				Name:  "rule-file",
 				Usage: "File to provision rules into.",
 			},
+			cli.StringFlag{
+				Name:  "ruler-url",
+				Usage: "Mimir or Cortex ruler address to push rule groups to instead of writing a rule file.",
+			},
+			cli.StringFlag{
+				Name:  "ruler-api-prefix",
+				Value: "/prometheus/config/v1/rules",
+				Usage: "Path of the ruler configuration API. Use /api/v1/rules for Cortex.",
+			},
+			cli.StringFlag{
+				Name:  "ruler-namespace",
+				Value: "mixtool",
+				Usage: "Ruler namespace to push rule groups to if the request does not specify one.",
+			},
+			cli.StringFlag{
+				Name:  "ruler-tenant-id",
+				Usage: "Tenant ID sent to the ruler in the X-Scope-OrgID header.",
+			},
+			cli.StringFlag{
+				Name:  "dashboards-dir",
+				Usage: "Grafana file provisioning directory to provision dashboards into. Folders are created as subdirectories.",
+			},
+			cli.StringFlag{
+				Name:  "grafana-url",
+				Usage: "Grafana address to provision dashboards to through its HTTP API.",
+			},
+			cli.StringFlag{
+				Name:  "grafana-token-file",
+				Usage: "File containing the Grafana service account token used to provision dashboards.",
+			},
+			cli.StringFlag{
+				Name:  "grafana-folder",
+				Usage: "Folder to provision dashboards into if the request does not specify one.",
+			},
+			cli.StringFlag{
+				Name:  "history-dir",
+				Usage: "Directory to record provisioned rules in, enabling the /api/v1/rules/history API.",
+			},
+			cli.IntFlag{
+				Name:  "history-limit",
+				Value: 10,
+				Usage: "Number of provisioned rule versions to keep in the history.",
+			},
+			cli.DurationFlag{
+				Name:  "sync-interval",
+				Value: 5 * time.Minute,
+				Usage: "Interval to evaluate the mixins listed in the sync section of the configuration file at.",
+			},
+			cli.StringFlag{
+				Name:  "config-file",
+				Usage: "YAML configuration file overriding the flags above. Reloaded on SIGHUP or a POST to /-/reload.",
+			},
+			cli.StringFlag{
+				Name:  "web-config-file",
+				Usage: "Path to a web configuration file enabling TLS, mTLS or basic authentication. See https://github.com/prometheus/exporter-toolkit/blob/master/docs/web-configuration.md",
+			},
+			cli.StringFlag{
+				Name:  "bearer-token-file",
+				Usage: "File containing a bearer token that clients must send in the Authorization header. /-/healthy and /-/ready are served without it.",
+			},
+			cli.BoolFlag{
+				Name:  "unauthenticated-metrics",
+				Usage: "Serve /metrics without the bearer token, for Prometheus servers that cannot send it.",
+			},
+			cli.DurationFlag{
+				Name:  "read-timeout",
+				Value: 30 * time.Second,
+				Usage: "Maximum duration for reading an entire request, including the body.",
+			},
+			cli.DurationFlag{
+				Name:  "write-timeout",
+				Value: 2 * time.Minute,
+				Usage: "Maximum duration before timing out writes of the response, including provisioning and reloading.",
+			},
+			cli.DurationFlag{
+				Name:  "shutdown-timeout",
+				Value: 2 * time.Minute,
+				Usage: "Maximum duration to wait for in-flight requests to finish when shutting down.",
+			},
+			cli.Int64Flag{
+				Name:  "max-body-size",
+				Value: 10 << 20,
+				Usage: "Maximum size of request bodies in bytes.",
+			},
 		},
 		Action: serverAction,
 	}
 }
 
 func serverAction(c *cli.Context) error {
-	bindAddress := c.String("bind-address")
-	http.Handle("/api/v1/rules", &ruleProvisioningHandler{
-		ruleProvisioner: &ruleProvisioner{
-			ruleFile: c.String("rule-file"),
-		},
-		prometheusReloader: &prometheusReloader{
-			prometheusReloadURL: c.String("prometheus-reload-url"),
-		},
-	})
-	return http.ListenAndServe(bindAddress, nil)
-}
+	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
 
-type ruleProvisioningHandler struct {
-	ruleProvisioner    *ruleProvisioner
-	prometheusReloader *prometheusReloader
-}
+	bindAddress := c.String("bind-address")
+	if bindAddress == "" {
+		// Keep the net/http default of listening on the HTTP port.
+		bindAddress = ":http"
+	}
 
-func (h *ruleProvisioningHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	if r.Method != "PUT" {
-		http.Error(w, "Bad request: only PUT requests supported", http.StatusBadRequest)
-		return
+	webConfigFile := c.String("web-config-file")
+	s := &mixtoolServer{
+		baseConfig:    serverConfigFromFlags(c),
+		configFile:    c.String("config-file"),
+		webConfigFile: webConfigFile,
+		maxBodySize:   c.Int64("max-body-size"),
+		metrics:       newServerMetrics(),
+		logger:        logger,
+	}
+	if err := s.reload(); err != nil {
+		return err
 	}
 
-	reloadNecessary, err := h.ruleProvisioner.provision(r.Body)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
-		return
+	server := &http.Server{
+		Handler:      s,
+		ReadTimeout:  c.Duration("read-timeout"),
+		WriteTimeout: c.Duration("write-timeout"),
 	}
 
-	if reloadNecessary {
-		if err := h.prometheusReloader.triggerReload(ctx); err != nil {
-			http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt)
+	shutdownErr := make(chan error, 1)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				if err := s.reload(); err != nil {
+					_ = logger.Log("msg", "Error reloading config", "err", err)
+				}
+				continue
+			}
+
+			_ = logger.Log("msg", "Shutting down, waiting for in-flight requests", "signal", sig)
+			ctx, cancel := context.WithTimeout(context.Background(), c.Duration("shutdown-timeout"))
+			shutdownErr <- server.Shutdown(ctx)
+			cancel()
 			return
 		}
+	}()
+
+	err := web.ListenAndServe(server, &web.FlagConfig{
+		WebListenAddresses: &[]string{bindAddress},
+		WebSystemdSocket:   new(bool),
+		WebConfigFile:      &webConfigFile,
+	}, logger)
+	s.stop()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	// Serving stops as soon as Shutdown is called, wait for it to
+	// finish the requests in flight.
+	return <-shutdownErr
 }
 
-type ruleProvisioner struct {
-	ruleFile string
+// mixtoolServer serves the handlers built from the current configuration,
+// which are replaced on each successful reload.
+type mixtoolServer struct {
+	baseConfig    serverConfig
+	configFile    string
+	webConfigFile string
+	maxBodySize   int64
+	metrics       *serverMetrics
+	logger        log.Logger
+
+	reloadMtx sync.Mutex
+	handler   atomic.Pointer[http.Handler]
+	// history is shared by the handlers of all configurations, so that
+	// they record rules one at a time. It is nil until a configuration
+	// enables it.
+	history *ruleHistory
+	// stopSync stops the syncer of the current configuration, if any.
+	stopSync func()
 }
 
-// provision attempts to provision the rule files read from r, and if identical
-// to existing, does not provision them. It returns whether Prometheus should
-// be reloaded and if an error has occurred.
-func (p *ruleProvisioner) provision(r io.Reader) (bool, error) {
-	newData, err := io.ReadAll(r)
-	if err != nil {
-		return false, fmt.Errorf("unable to read new rules: %w", err)
+func (s *mixtoolServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.maxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodySize)
 	}
+	(*s.handler.Load()).ServeHTTP(w, r)
+}
+
+// reload loads and validates the configuration and only applies it
+// if it is valid, keeping the previous configuration otherwise.
+func (s *mixtoolServer) reload() (err error) {
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
 
-	tempfile, err := os.CreateTemp(filepath.Dir(p.ruleFile), "temp-mixtool")
+	defer func() {
+		if err != nil {
+			s.metrics.configReloadSuccess.Set(0)
+			return
+		}
+		s.metrics.configReloadSuccess.Set(1)
+		s.metrics.configReloadTimestamp.SetToCurrentTime()
+	}()
+
+	cfg, err := loadServerConfig(s.baseConfig, s.configFile)
 	if err != nil {
-		return false, fmt.Errorf("unable to create temp file: %w", err)
+		return err
+	}
+	if err := validateWebConfig(s.webConfigFile, cfg.BearerTokenFile); err != nil {
+		return err
+	}
+
+	var history *ruleHistory
+	if cfg.History.Directory != "" {
+		if s.history == nil {
+			s.history = &ruleHistory{}
+		}
+		s.history.configure(cfg.History.Directory, cfg.History.Limit)
+		history = s.history
 	}
 
-	n, err := tempfile.Write(newData)
+	rules := s.ruleProvisioningHandler(cfg, history)
+	handler, err := s.buildHandler(cfg, rules, history)
 	if err != nil {
-		return false, fmt.Errorf("error when writing new rules: %w", err)
+		return err
 	}
+	s.handler.Store(&handler)
+	s.startSync(cfg, rules)
 
-	if n != len(newData) {
-		return false, fmt.Errorf("writing error, wrote %d bytes, expected %d", n, len(newData))
+	if cfg.RuleFile != "" {
+		content, err := os.ReadFile(cfg.RuleFile)
+		if err == nil {
+			err = s.metrics.updateRules(content)
+		}
+		if err != nil {
+			_ = s.logger.Log("msg", "Unable to read rule file", "file", cfg.RuleFile, "err", err)
+		}
 	}
 
-	if err := tempfile.Sync(); err != nil {
-		return false, err
+	if s.configFile != "" {
+		_ = s.logger.Log("msg", "Loaded configuration", "file", s.configFile)
 	}
+	return nil
+}
 
-	ruleFileReader, err := os.OpenFile(p.ruleFile, os.O_RDWR, 0644)
-	if err != nil {
-		return false, fmt.Errorf("unable to read existing rules: %w", err)
+// startSync replaces the running syncer with one for the mixins in cfg.
+func (s *mixtoolServer) startSync(cfg *serverConfig, rules *ruleProvisioningHandler) {
+	if s.stopSync != nil {
+		s.stopSync()
+		s.stopSync = nil
+	}
+	if len(cfg.Sync.Mixins) == 0 {
+		return
 	}
 
-	newFileReader, err := os.OpenFile(tempfile.Name(), os.O_RDWR, 0644)
-	if err != nil {
-		return false, fmt.Errorf("unable to open new rules file: %w", err)
+	syncer := &ruleSyncer{
+		mixins:     cfg.Sync.Mixins,
+		interval:   cfg.Sync.Interval,
+		namespaced: cfg.Ruler.URL != "",
+		rules:      rules,
+		metrics:    s.metrics,
+		logger:     s.logger,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		syncer.run(ctx)
+	}()
+	s.stopSync = func() {
+		cancel()
+		<-done
+	}
+}
+
+// stop stops the background work of the server.
+func (s *mixtoolServer) stop() {
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+	if s.stopSync != nil {
+		s.stopSync()
+		s.stopSync = nil
+	}
+}
+
+// ruleProvisioningHandler returns the handler provisioning rules as
+// configured by cfg, recording them in history unless it is nil.
+func (s *mixtoolServer) ruleProvisioningHandler(cfg *serverConfig, history *ruleHistory) *ruleProvisioningHandler {
+	ruleProvisioner, reloader := cfg.ruleProvisioner()
+
+	return &ruleProvisioningHandler{
+		ruleProvisioner:  ruleProvisioner,
+		reloader:         reloader,
+		defaultNamespace: cfg.Ruler.Namespace,
+		history:          history,
+		metrics:          s.metrics,
+		logger:           s.logger,
+	}
+}
+
+func (s *mixtoolServer) buildHandler(cfg *serverConfig, rules *ruleProvisioningHandler, history *ruleHistory) (http.Handler, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/rules", rules)
+	if history != nil {
+		(&historyHandler{history: history, rules: rules}).register(mux)
 	}
 
-	equal, err := readersEqual(newFileReader, ruleFileReader)
+	dashboardProvisioner, err := cfg.dashboardProvisioner()
 	if err != nil {
-		return false, fmt.Errorf("error from readersEqual: %w", err)
+		return nil, err
+	}
+	if dashboardProvisioner != nil {
+		mux.Handle("/api/v1/dashboards", &dashboardProvisioningHandler{
+			dashboardProvisioner: dashboardProvisioner,
+			defaultFolder:        cfg.Dashboards.Folder,
+			metrics:              s.metrics,
+			logger:               s.logger,
+		})
 	}
 
-	if equal {
-		return false, nil
+	mux.HandleFunc("/-/reload", s.reloadHandler)
+
+	// Liveness and readiness probes cannot send the bearer token, so the
+	// health endpoints are served without it. Scrapes of the metrics have to
+	// send it unless unauthenticated metrics are enabled.
+	public := http.NewServeMux()
+	public.HandleFunc("/-/healthy", healthyHandler)
+	public.Handle("/-/ready", &readyHandler{ruleFile: cfg.RuleFile})
+	metrics := promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+	if cfg.UnauthenticatedMetrics {
+		public.Handle("/metrics", metrics)
+	} else {
+		mux.Handle("/metrics", metrics)
 	}
 
-	if err = os.Rename(tempfile.Name(), p.ruleFile); err != nil {
-		return false, fmt.Errorf("cannot rename rules file: %w", err)
+	var handler http.Handler = mux
+	if cfg.BearerTokenFile != "" {
+		token, err := readBearerToken(cfg.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		handler = &bearerTokenHandler{token: token, handler: handler}
 	}
-	return true, nil
+	public.Handle("/", handler)
+	return public, nil
 }
 
-type prometheusReloader struct {
-	prometheusReloadURL string
+func (s *mixtoolServer) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "PUT" {
+		http.Error(w, "Bad request: only POST or PUT requests supported", http.StatusBadRequest)
+		return
+	}
+	if err := s.reload(); err != nil {
+		_ = s.logger.Log("msg", "Error reloading config", "err", err)
+		http.Error(w, fmt.Sprintf("Failed to reload config: %v", err), http.StatusInternalServerError)
+	}
 }
 
-func readersEqual(r1, r2 io.Reader) (bool, error) {
-	buf1 := bufio.NewReader(r1)
-	buf2 := bufio.NewReader(r2)
-	for {
-		b1, err1 := buf1.ReadByte()
-		b2, err2 := buf2.ReadByte()
-		if err1 != nil && !errors.Is(err1, io.EOF) {
-			return false, err1
-		}
-		if err2 != nil && !errors.Is(err2, io.EOF) {
-			return false, err2
-		}
-		if errors.Is(err1, io.EOF) || errors.Is(err2, io.EOF) {
-			return err1 == err2, nil
-		}
-		if b1 != b2 {
-			return false, nil
-		}
+// validateWebConfig checks the web configuration file, including its TLS
+// certificates, before the server starts. Basic authentication and bearer
+// tokens both use the Authorization header, so only one of them can be enabled.
+func validateWebConfig(webConfigFile, bearerTokenFile string) error {
+	if webConfigFile == "" {
+		return nil
+	}
+	if err := web.Validate(webConfigFile); err != nil {
+		return fmt.Errorf("invalid web config file %s: %w", webConfigFile, err)
+	}
+	if bearerTokenFile == "" {
+		return nil
 	}
-}
 
-func (r *prometheusReloader) triggerReload(ctx context.Context) error {
-	req, err := http.NewRequest("POST", r.prometheusReloadURL, nil)
+	content, err := os.ReadFile(webConfigFile)
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return err
+	}
+	var cfg web.Config
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return fmt.Errorf("invalid web config file %s: %w", webConfigFile, err)
+	}
+	if len(cfg.Users) > 0 {
+		return fmt.Errorf("basic_auth_users in %s cannot be combined with a bearer token", webConfigFile)
 	}
-	req = req.WithContext(ctx)
+	return nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func readBearerToken(filename string) (string, error) {
+	content, err := os.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("reload request: %w", err)
+		return "", fmt.Errorf("unable to read bearer token: %w", err)
 	}
-
-	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
-		return fmt.Errorf("exhausting request body: %w", err)
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("bearer token file %s is empty", filename)
 	}
+	return token, nil
+}
+
+// bearerTokenKey is the request context key marking requests authenticated
+// by a bearerTokenHandler.
+type bearerTokenKey struct{}
+
+// bearerTokenHandler only passes requests on to handler if they carry the
+// expected bearer token.
+type bearerTokenHandler struct {
+	token   string
+	handler http.Handler
+}
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("received non-200 response: %s; have you set `--web.enable-lifecycle` Prometheus flag?", resp.Status)
+func (h *bearerTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
 	}
-	return nil
+	h.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bearerTokenKey{}, true)))
 }
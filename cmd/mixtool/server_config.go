@@ -0,0 +1,293 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+const defaultPrometheusReloadURL = "http://127.0.0.1:9090/-/reload"
+
+// serverConfig is the reloadable configuration of mixtool server.
+// It is made of the command line flags, overridden by the fields
+// set in the configuration file.
+type serverConfig struct {
+	RuleFile              string   `yaml:"rule_file"`
+	PrometheusReloadURLs  []string `yaml:"prometheus_reload_urls"`
+	ThanosRulerReloadURLs []string `yaml:"thanos_ruler_reload_urls"`
+
+	Ruler      rulerConfig      `yaml:"ruler"`
+	Dashboards dashboardsConfig `yaml:"dashboards"`
+	History    historyConfig    `yaml:"history"`
+	Sync       syncConfig       `yaml:"sync"`
+
+	BearerTokenFile string `yaml:"bearer_token_file"`
+	// UnauthenticatedMetrics serves /metrics without the bearer token.
+	UnauthenticatedMetrics bool `yaml:"unauthenticated_metrics"`
+}
+
+type rulerConfig struct {
+	URL       string `yaml:"url"`
+	APIPrefix string `yaml:"api_prefix"`
+	Namespace string `yaml:"namespace"`
+	TenantID  string `yaml:"tenant_id"`
+}
+
+type dashboardsConfig struct {
+	Directory        string `yaml:"directory"`
+	GrafanaURL       string `yaml:"grafana_url"`
+	GrafanaTokenFile string `yaml:"grafana_token_file"`
+	Folder           string `yaml:"folder"`
+}
+
+type historyConfig struct {
+	Directory string `yaml:"directory"`
+	Limit     int    `yaml:"limit"`
+}
+
+// syncConfig lists the mixins whose rules mixtool server evaluates and
+// provisions by itself.
+type syncConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Mixins   []syncMixin   `yaml:"mixins"`
+}
+
+type syncMixin struct {
+	Name string `yaml:"name"`
+	// File is the mixin to evaluate, usually a mixin.libsonnet.
+	File   string   `yaml:"file"`
+	JPaths []string `yaml:"jpath"`
+	// JsonnetfileDir is a jsonnet-bundler project whose dependencies are
+	// installed before evaluating the mixin, and updated to their latest
+	// version with Update.
+	JsonnetfileDir string `yaml:"jsonnetfile_dir"`
+	Update         bool   `yaml:"update"`
+	// Namespace is the ruler namespace of the rules, defaulting to the
+	// name of the mixin. Rules of all mixins are combined in a rule file.
+	Namespace string `yaml:"namespace"`
+}
+
+// serverConfigFromFlags returns the configuration given on the command line.
+func serverConfigFromFlags(c *cli.Context) serverConfig {
+	return serverConfig{
+		RuleFile:              c.String("rule-file"),
+		PrometheusReloadURLs:  c.StringSlice("prometheus-reload-url"),
+		ThanosRulerReloadURLs: c.StringSlice("thanos-ruler-reload-url"),
+		Ruler: rulerConfig{
+			URL:       c.String("ruler-url"),
+			APIPrefix: c.String("ruler-api-prefix"),
+			Namespace: c.String("ruler-namespace"),
+			TenantID:  c.String("ruler-tenant-id"),
+		},
+		Dashboards: dashboardsConfig{
+			Directory:        c.String("dashboards-dir"),
+			GrafanaURL:       c.String("grafana-url"),
+			GrafanaTokenFile: c.String("grafana-token-file"),
+			Folder:           c.String("grafana-folder"),
+		},
+		History: historyConfig{
+			Directory: c.String("history-dir"),
+			Limit:     c.Int("history-limit"),
+		},
+		Sync: syncConfig{
+			Interval: c.Duration("sync-interval"),
+		},
+		BearerTokenFile:        c.String("bearer-token-file"),
+		UnauthenticatedMetrics: c.Bool("unauthenticated-metrics"),
+	}
+}
+
+// loadServerConfig applies the configuration file, if any, on top of base
+// and validates the result. Relative paths in the file are resolved
+// against the directory of the file.
+func loadServerConfig(base serverConfig, filename string) (*serverConfig, error) {
+	cfg := base
+	if filename != "" {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config file: %w", err)
+		}
+
+		var fileCfg serverConfig
+		if err := yaml.UnmarshalStrict(content, &fileCfg); err != nil {
+			return nil, fmt.Errorf("unable to parse config file %s: %w", filename, err)
+		}
+		// The keys present in the file, to tell fields set to their zero
+		// value apart from missing ones.
+		var keys map[interface{}]interface{}
+		if err := yaml.Unmarshal(content, &keys); err != nil {
+			return nil, fmt.Errorf("unable to parse config file %s: %w", filename, err)
+		}
+		fileCfg.setDirectory(filepath.Dir(filename))
+		cfg.merge(fileCfg, keys)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// merge overrides the fields of c with the ones of o whose keys are
+// present in keys, the configuration file decoded into a generic map.
+// Fields set to their zero value in the file, like an empty bearer token
+// file or false, override the flags as well.
+func (c *serverConfig) merge(o serverConfig, keys map[interface{}]interface{}) {
+	mergeKeys(reflect.ValueOf(c).Elem(), reflect.ValueOf(o), keys)
+}
+
+// mergeKeys copies the fields of the struct src whose yaml keys are present
+// in keys into dst. Nested structs given as a mapping are merged field by
+// field, anything else replaces the field as a whole.
+func mergeKeys(dst, src reflect.Value, keys map[interface{}]interface{}) {
+	for i := 0; i < dst.NumField(); i++ {
+		key, _, _ := strings.Cut(dst.Type().Field(i).Tag.Get("yaml"), ",")
+		value, ok := keys[key]
+		if !ok {
+			continue
+		}
+		if nested, ok := value.(map[interface{}]interface{}); ok && dst.Field(i).Kind() == reflect.Struct {
+			mergeKeys(dst.Field(i), src.Field(i), nested)
+			continue
+		}
+		dst.Field(i).Set(src.Field(i))
+	}
+}
+
+func (c *serverConfig) setDirectory(dir string) {
+	c.RuleFile = joinDir(dir, c.RuleFile)
+	c.BearerTokenFile = joinDir(dir, c.BearerTokenFile)
+	c.Dashboards.Directory = joinDir(dir, c.Dashboards.Directory)
+	c.Dashboards.GrafanaTokenFile = joinDir(dir, c.Dashboards.GrafanaTokenFile)
+	c.History.Directory = joinDir(dir, c.History.Directory)
+	for i := range c.Sync.Mixins {
+		m := &c.Sync.Mixins[i]
+		m.File = joinDir(dir, m.File)
+		m.JsonnetfileDir = joinDir(dir, m.JsonnetfileDir)
+		for j := range m.JPaths {
+			m.JPaths[j] = joinDir(dir, m.JPaths[j])
+		}
+	}
+}
+
+func joinDir(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func (c *serverConfig) validate() error {
+	if c.Ruler.URL != "" {
+		if c.RuleFile != "" {
+			return fmt.Errorf("only one of rule file and ruler URL can be set")
+		}
+		if len(c.PrometheusReloadURLs) > 0 || len(c.ThanosRulerReloadURLs) > 0 {
+			return fmt.Errorf("reload URLs cannot be used with a ruler URL, the ruler picks up changes by itself")
+		}
+	} else if c.RuleFile != "" {
+		if _, err := os.Stat(filepath.Dir(c.RuleFile)); err != nil {
+			return fmt.Errorf("invalid rule file: %w", err)
+		}
+	}
+
+	if c.Dashboards.Directory != "" && c.Dashboards.GrafanaURL != "" {
+		return fmt.Errorf("only one of dashboards directory and Grafana URL can be set")
+	}
+
+	if c.History.Directory != "" && c.History.Limit < 1 {
+		return fmt.Errorf("history limit must be at least 1, got %d", c.History.Limit)
+	}
+
+	return c.Sync.validate()
+}
+
+func (c *syncConfig) validate() error {
+	if len(c.Mixins) == 0 {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("sync interval must be positive, got %s", c.Interval)
+	}
+
+	names := map[string]bool{}
+	for _, m := range c.Mixins {
+		if m.Name == "" {
+			return fmt.Errorf("sync mixins must have a name")
+		}
+		if names[m.Name] {
+			return fmt.Errorf("duplicate sync mixin %s", m.Name)
+		}
+		names[m.Name] = true
+		if m.File == "" {
+			return fmt.Errorf("no file given for sync mixin %s", m.Name)
+		}
+		if m.Update && m.JsonnetfileDir == "" {
+			return fmt.Errorf("sync mixin %s can only be updated with a jsonnetfile_dir", m.Name)
+		}
+	}
+	return nil
+}
+
+// ruleProvisioner returns the configured rule provisioner and the reloader
+// for its targets, which is nil when pushing to a ruler.
+func (c *serverConfig) ruleProvisioner() (ruleProvisioner, reloader) {
+	if c.Ruler.URL != "" {
+		return newRulerProvisioner(c.Ruler.URL, c.Ruler.APIPrefix, c.Ruler.TenantID), nil
+	}
+
+	prometheusURLs := c.PrometheusReloadURLs
+	if len(prometheusURLs) == 0 && len(c.ThanosRulerReloadURLs) == 0 {
+		prometheusURLs = []string{defaultPrometheusReloadURL}
+	}
+
+	var reloaders multiReloader
+	for _, u := range prometheusURLs {
+		reloaders = append(reloaders, &prometheusReloader{prometheusReloadURL: u})
+	}
+	for _, u := range c.ThanosRulerReloadURLs {
+		reloaders = append(reloaders, &thanosRulerReloader{reloadURL: u})
+	}
+
+	return &fileRuleProvisioner{ruleFile: c.RuleFile}, reloaders
+}
+
+// dashboardProvisioner returns the configured dashboard provisioner,
+// or nil if dashboard provisioning is disabled.
+func (c *serverConfig) dashboardProvisioner() (dashboardProvisioner, error) {
+	switch {
+	case c.Dashboards.Directory != "":
+		return &fileDashboardProvisioner{directory: c.Dashboards.Directory}, nil
+	case c.Dashboards.GrafanaURL != "":
+		var token string
+		if c.Dashboards.GrafanaTokenFile != "" {
+			var err error
+			token, err = readBearerToken(c.Dashboards.GrafanaTokenFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return newGrafanaDashboardProvisioner(c.Dashboards.GrafanaURL, token), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "mixtool.yml")
+	err := os.WriteFile(configFile, []byte(`rule_file: rules.yaml
+thanos_ruler_reload_urls:
+- http://thanos-ruler:10902/-/reload
+dashboards:
+  folder: Mixins
+`), 0644)
+	assert.NoError(t, err)
+
+	base := serverConfig{
+		RuleFile:             "/etc/prometheus/rules.yaml",
+		PrometheusReloadURLs: []string{"http://prometheus:9090/-/reload"},
+		Ruler:                rulerConfig{Namespace: "mixtool"},
+	}
+	cfg, err := loadServerConfig(base, configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "rules.yaml"), cfg.RuleFile)
+	assert.Equal(t, []string{"http://prometheus:9090/-/reload"}, cfg.PrometheusReloadURLs)
+	assert.Equal(t, []string{"http://thanos-ruler:10902/-/reload"}, cfg.ThanosRulerReloadURLs)
+	assert.Equal(t, "Mixins", cfg.Dashboards.Folder)
+	assert.Equal(t, "mixtool", cfg.Ruler.Namespace)
+
+	// Fields set to their zero value in the file override the flags too.
+	err = os.WriteFile(configFile, []byte("bearer_token_file: ''\nunauthenticated_metrics: false\nprometheus_reload_urls: []\nruler:\n  tenant_id: ''\n"), 0644)
+	assert.NoError(t, err)
+	cfg, err = loadServerConfig(serverConfig{
+		RuleFile:               filepath.Join(dir, "flag.yaml"),
+		PrometheusReloadURLs:   []string{"http://prometheus:9090/-/reload"},
+		Ruler:                  rulerConfig{Namespace: "mixtool", TenantID: "tenant"},
+		BearerTokenFile:        "/etc/mixtool/token",
+		UnauthenticatedMetrics: true,
+	}, configFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, filepath.Join(dir, "flag.yaml"), cfg.RuleFile)
+	assert.Empty(t, cfg.PrometheusReloadURLs)
+	assert.Equal(t, rulerConfig{Namespace: "mixtool"}, cfg.Ruler)
+	assert.Empty(t, cfg.BearerTokenFile)
+	assert.False(t, cfg.UnauthenticatedMetrics)
+
+	err = os.WriteFile(configFile, []byte("rule_fille: rules.yaml\n"), 0644)
+	assert.NoError(t, err)
+	_, err = loadServerConfig(base, configFile)
+	assert.Error(t, err, "unknown fields must be rejected")
+
+	err = os.WriteFile(configFile, []byte("ruler:\n  url: http://mimir\n"), 0644)
+	assert.NoError(t, err)
+	_, err = loadServerConfig(base, configFile)
+	assert.Error(t, err, "rule file and ruler must be exclusive")
+}
+
+func TestMixtoolServerReload(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "mixtool.yml")
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+	assert.NoError(t, os.WriteFile(configFile, []byte("rule_file: rules.yaml\n"), 0644))
+
+	s := &mixtoolServer{
+		configFile: configFile,
+		metrics:    newServerMetrics(),
+		logger:     log.NewNopLogger(),
+	}
+	assert.NoError(t, s.reload())
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, get("/-/healthy"))
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/dashboards"))
+
+	// An invalid configuration is not applied.
+	assert.NoError(t, os.WriteFile(configFile, []byte("rule_file: does/not/exist.yaml\nbearer_token_file: token\n"), 0644))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("POST", "/-/reload", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, 0.0, testutil.ToFloat64(s.metrics.configReloadSuccess))
+	assert.Equal(t, http.StatusOK, get("/-/healthy"))
+
+	assert.NoError(t, os.WriteFile(configFile, []byte("rule_file: rules.yaml\nbearer_token_file: token\ndashboards:\n  directory: dashboards\n"), 0644))
+	assert.NoError(t, s.reload())
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.configReloadSuccess))
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/dashboards", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/dashboards"))
+}
+
+func TestMixtoolServerReloadHistory(t *testing.T) {
+	prometheus := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer prometheus.Close()
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "mixtool.yml")
+	config := "rule_file: rules.yaml\nprometheus_reload_urls: [" + prometheus.URL + "]\nhistory:\n  directory: history\n  limit: %d\n"
+	assert.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(config, 2)), 0644))
+
+	s := &mixtoolServer{
+		configFile: configFile,
+		metrics:    newServerMetrics(),
+		logger:     log.NewNopLogger(),
+	}
+	assert.NoError(t, s.reload())
+	history := s.history
+
+	// The handlers of every configuration record into the same history.
+	assert.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(config, 5)), 0644))
+	assert.NoError(t, s.reload())
+	assert.Same(t, history, s.history)
+	assert.Equal(t, 5, s.history.limit)
+
+	req := httptest.NewRequest("PUT", "/api/v1/rules", strings.NewReader("groups:\n- name: g\n  rules:\n  - {record: a, expr: vector(1)}\n"))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	entries, err := history.list()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,316 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// errDashboardExists is returned when a dashboard already exists and
+// overwriting it was not requested.
+var errDashboardExists = errors.New("dashboard already exists")
+
+// dashboardProvisioner provisions Grafana dashboards, as generated from
+// a mixin's grafanaDashboards, into the given folder.
+type dashboardProvisioner interface {
+	provision(ctx context.Context, folder string, dashboards map[string]json.RawMessage, overwrite bool) error
+}
+
+type dashboardProvisioningHandler struct {
+	dashboardProvisioner dashboardProvisioner
+	defaultFolder        string
+	metrics              *serverMetrics
+	logger               log.Logger
+}
+
+// ServeHTTP accepts a JSON object of dashboard filenames to dashboards.
+// The folder query parameter selects the Grafana folder, and overwrite=false
+// refuses to replace existing dashboards.
+func (h *dashboardProvisioningHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		h.metrics.dashboardProvisionRequests.WithLabelValues(provisionResultRejected).Inc()
+		http.Error(w, "Bad request: only PUT requests supported", http.StatusBadRequest)
+		return
+	}
+
+	var dashboards map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&dashboards); err != nil {
+		h.metrics.dashboardProvisionRequests.WithLabelValues(provisionResultRejected).Inc()
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Request Entity Too Large: dashboards exceed %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Bad request: invalid dashboards: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	folder := r.URL.Query().Get("folder")
+	if folder == "" {
+		folder = h.defaultFolder
+	}
+
+	overwrite := true
+	if o := r.URL.Query().Get("overwrite"); o != "" {
+		var err error
+		overwrite, err = strconv.ParseBool(o)
+		if err != nil {
+			h.metrics.dashboardProvisionRequests.WithLabelValues(provisionResultRejected).Inc()
+			http.Error(w, fmt.Sprintf("Bad request: invalid overwrite parameter: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.dashboardProvisioner.provision(r.Context(), folder, dashboards, overwrite); err != nil {
+		if errors.Is(err, errDashboardExists) {
+			h.metrics.dashboardProvisionRequests.WithLabelValues(provisionResultRejected).Inc()
+			http.Error(w, fmt.Sprintf("Conflict: %v", err), http.StatusConflict)
+			return
+		}
+		h.metrics.dashboardProvisionRequests.WithLabelValues(provisionResultError).Inc()
+		_ = h.logger.Log("msg", "Unable to provision dashboards", "folder", folder, "err", err)
+		http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	h.metrics.dashboardProvisionRequests.WithLabelValues(provisionResultUpdated).Inc()
+}
+
+// fileDashboardProvisioner writes dashboards into a directory read by
+// Grafana's file provisioning. Folders are subdirectories, to be used with
+// the foldersFromFilesStructure provider option.
+type fileDashboardProvisioner struct {
+	directory string
+}
+
+func (p *fileDashboardProvisioner) provision(_ context.Context, folder string, dashboards map[string]json.RawMessage, overwrite bool) error {
+	dir := p.directory
+	if folder != "" {
+		if !isPlainFilename(folder) {
+			return fmt.Errorf("invalid folder name %q", folder)
+		}
+		dir = filepath.Join(dir, folder)
+	}
+
+	for name, dashboard := range dashboards {
+		if !isPlainFilename(name) {
+			return fmt.Errorf("invalid dashboard filename %q", name)
+		}
+		if overwrite {
+			continue
+		}
+		existing, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(existing, dashboard) {
+			return fmt.Errorf("%w: %s", errDashboardExists, path.Join(folder, name))
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create dashboard directory: %w", err)
+	}
+
+	for name, dashboard := range dashboards {
+		if err := writeFileAtomic(filepath.Join(dir, name), dashboard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isPlainFilename reports whether name refers to an entry directly inside
+// a directory, without escaping it.
+func isPlainFilename(name string) bool {
+	return name != "" && name != "." && name != ".." && name == filepath.Base(name)
+}
+
+// writeFileAtomic replaces filename with data by renaming a temporary file,
+// so readers never see partially written content.
+func writeFileAtomic(filename string, data []byte) error {
+	tempfile, err := os.CreateTemp(filepath.Dir(filename), "temp-mixtool")
+	if err != nil {
+		return fmt.Errorf("unable to create temp file: %w", err)
+	}
+	defer func() { _ = os.Remove(tempfile.Name()) }()
+
+	if _, err := tempfile.Write(data); err != nil {
+		_ = tempfile.Close()
+		return fmt.Errorf("unable to write %s: %w", filename, err)
+	}
+	if err := tempfile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempfile.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempfile.Name(), filename)
+}
+
+// grafanaDashboardProvisioner pushes dashboards to Grafana's HTTP API.
+type grafanaDashboardProvisioner struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newGrafanaDashboardProvisioner(grafanaURL, token string) *grafanaDashboardProvisioner {
+	return &grafanaDashboardProvisioner{
+		url:    grafanaURL,
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *grafanaDashboardProvisioner) provision(ctx context.Context, folder string, dashboards map[string]json.RawMessage, overwrite bool) error {
+	var folderUID string
+	if folder != "" {
+		var err error
+		folderUID, err = p.ensureFolder(ctx, folder)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, raw := range dashboards {
+		var dashboard map[string]interface{}
+		if err := json.Unmarshal(raw, &dashboard); err != nil {
+			return fmt.Errorf("invalid dashboard %s: %w", name, err)
+		}
+		// Dashboards are matched by their UID, the numeric ID is specific
+		// to the Grafana instance they have been exported from.
+		dashboard["id"] = nil
+
+		body := map[string]interface{}{
+			"dashboard": dashboard,
+			"folderUid": folderUID,
+			"overwrite": overwrite,
+			"message":   "Provisioned by mixtool",
+		}
+		status, err := p.do(ctx, "POST", "/api/dashboards/db", body, nil)
+		if err != nil {
+			return fmt.Errorf("unable to provision dashboard %s: %w", name, err)
+		}
+		switch status {
+		case http.StatusOK:
+		case http.StatusPreconditionFailed:
+			return fmt.Errorf("%w: %s", errDashboardExists, name)
+		default:
+			return fmt.Errorf("unable to provision dashboard %s: received status %d", name, status)
+		}
+	}
+	return nil
+}
+
+type grafanaFolder struct {
+	UID   string `json:"uid"`
+	Title string `json:"title"`
+}
+
+// ensureFolder returns the UID of the folder with the given title,
+// creating the folder if it does not exist.
+func (p *grafanaDashboardProvisioner) ensureFolder(ctx context.Context, title string) (string, error) {
+	var folders []grafanaFolder
+	status, err := p.do(ctx, "GET", "/api/folders?limit=1000", nil, &folders)
+	if err != nil {
+		return "", fmt.Errorf("unable to list folders: %w", err)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("unable to list folders: received status %d", status)
+	}
+	for _, f := range folders {
+		if f.Title == title {
+			return f.UID, nil
+		}
+	}
+
+	var created grafanaFolder
+	status, err = p.do(ctx, "POST", "/api/folders", map[string]string{"title": title}, &created)
+	if err != nil {
+		return "", fmt.Errorf("unable to create folder %s: %w", title, err)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("unable to create folder %s: received status %d", title, status)
+	}
+	return created.UID, nil
+}
+
+// do sends body as JSON to the Grafana API and decodes successful responses
+// into out, if given. It returns the response status code.
+func (p *grafanaDashboardProvisioner) do(ctx context.Context, method, apiPath string, body, out interface{}) (int, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return 0, err
+	}
+	ref, err := url.Parse(apiPath)
+	if err != nil {
+		return 0, err
+	}
+	u.Path = path.Join(u.Path, ref.Path)
+	u.RawQuery = ref.RawQuery
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return 0, fmt.Errorf("decoding response: %w", err)
+		}
+		return resp.StatusCode, nil
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, fmt.Errorf("exhausting request body: %w", err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileDashboardProvisioner(t *testing.T) {
+	dir := t.TempDir()
+	p := &fileDashboardProvisioner{directory: dir}
+	ctx := context.Background()
+
+	dashboards := map[string]json.RawMessage{"a.json": json.RawMessage(`{"uid":"a"}`)}
+	assert.NoError(t, p.provision(ctx, "Team", dashboards, false))
+
+	content, err := os.ReadFile(filepath.Join(dir, "Team", "a.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"uid":"a"}`, string(content))
+
+	// Provisioning identical dashboards again is not a conflict.
+	assert.NoError(t, p.provision(ctx, "Team", dashboards, false))
+
+	changed := map[string]json.RawMessage{"a.json": json.RawMessage(`{"uid":"a","title":"A"}`)}
+	assert.ErrorIs(t, p.provision(ctx, "Team", changed, false), errDashboardExists)
+	assert.NoError(t, p.provision(ctx, "Team", changed, true))
+
+	content, err = os.ReadFile(filepath.Join(dir, "Team", "a.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"uid":"a","title":"A"}`, string(content))
+
+	assert.Error(t, p.provision(ctx, "..", dashboards, true))
+	assert.Error(t, p.provision(ctx, "", map[string]json.RawMessage{"../a.json": nil}, true))
+}
+
+// fakeGrafana implements the parts of the Grafana HTTP API used to provision dashboards.
+type fakeGrafana struct {
+	mtx        sync.Mutex
+	folders    []grafanaFolder
+	dashboards map[string]map[string]interface{}
+}
+
+func (g *fakeGrafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/folders":
+		_ = json.NewEncoder(w).Encode(g.folders)
+	case r.Method == "POST" && r.URL.Path == "/api/folders":
+		var f grafanaFolder
+		_ = json.NewDecoder(r.Body).Decode(&f)
+		f.UID = strings.ToLower(f.Title)
+		g.folders = append(g.folders, f)
+		_ = json.NewEncoder(w).Encode(f)
+	case r.Method == "POST" && r.URL.Path == "/api/dashboards/db":
+		var body struct {
+			Dashboard map[string]interface{} `json:"dashboard"`
+			FolderUID string                 `json:"folderUid"`
+			Overwrite bool                   `json:"overwrite"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		uid := body.Dashboard["uid"].(string)
+		if _, ok := g.dashboards[uid]; ok && !body.Overwrite {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body.Dashboard["folderUid"] = body.FolderUID
+		g.dashboards[uid] = body.Dashboard
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestGrafanaDashboardProvisioner(t *testing.T) {
+	grafana := &fakeGrafana{dashboards: map[string]map[string]interface{}{}}
+	ts := httptest.NewServer(grafana)
+	defer ts.Close()
+
+	h := &dashboardProvisioningHandler{
+		dashboardProvisioner: newGrafanaDashboardProvisioner(ts.URL, "token"),
+		metrics:              newServerMetrics(),
+		logger:               log.NewNopLogger(),
+	}
+
+	put := func(query, body string) int {
+		req := httptest.NewRequest("PUT", "/api/v1/dashboards"+query, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, put("?folder=Kubernetes", `{"a.json":{"id":12,"uid":"a","title":"A"}}`))
+	assert.Len(t, grafana.folders, 1)
+	assert.Equal(t, "kubernetes", grafana.dashboards["a"]["folderUid"])
+	assert.Nil(t, grafana.dashboards["a"]["id"])
+
+	assert.Equal(t, http.StatusConflict, put("?folder=Kubernetes&overwrite=false", `{"a.json":{"uid":"a","title":"B"}}`))
+	assert.Equal(t, "A", grafana.dashboards["a"]["title"])
+
+	assert.Equal(t, http.StatusOK, put("?folder=Kubernetes", `{"a.json":{"uid":"a","title":"B"}}`))
+	assert.Len(t, grafana.folders, 1)
+	assert.Equal(t, "B", grafana.dashboards["a"]["title"])
+
+	assert.Equal(t, http.StatusBadRequest, put("", `not json`))
+}
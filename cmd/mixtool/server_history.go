@@ -0,0 +1,313 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// historyEntry describes a provisioned version of the rules.
+type historyEntry struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Namespace  string    `json:"namespace,omitempty"`
+	SHA256     string    `json:"sha256"`
+	Size       int       `json:"size"`
+	Client     string    `json:"client,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+}
+
+func newHistoryEntry(namespace string, content []byte, client, remoteAddr string) historyEntry {
+	now := time.Now().UTC()
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	return historyEntry{
+		// IDs sort in the order the entries have been recorded.
+		ID:         fmt.Sprintf("%d-%s", now.UnixNano(), hash[:12]),
+		Timestamp:  now,
+		Namespace:  namespace,
+		SHA256:     hash,
+		Size:       len(content),
+		Client:     client,
+		RemoteAddr: remoteAddr,
+	}
+}
+
+// clientIdentity returns the name the client authenticated with, either
+// as basic auth user or with a TLS client certificate. Clients that sent
+// the bearer token are all "bearer-token", unauthenticated clients are
+// identified by their address.
+func clientIdentity(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if authenticated, _ := r.Context().Value(bearerTokenKey{}).(bool); authenticated {
+		return "bearer-token"
+	}
+	return r.RemoteAddr
+}
+
+var errHistoryNotFound = errors.New("history entry not found")
+
+// ruleHistory keeps the most recent provisioned rules in a directory,
+// each version as a rules file next to its JSON metadata.
+type ruleHistory struct {
+	directory string
+	limit     int
+
+	mtx sync.Mutex
+}
+
+// configure changes the directory and limit of the history, once the
+// entries being recorded are done.
+func (h *ruleHistory) configure(directory string, limit int) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.directory, h.limit = directory, limit
+}
+
+func (h *ruleHistory) add(entry historyEntry, content []byte) error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if err := os.MkdirAll(h.directory, 0755); err != nil {
+		return err
+	}
+
+	metadata, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(h.directory, entry.ID+".rules"), content); err != nil {
+		return err
+	}
+	// The metadata is written last, as it marks the entry as complete.
+	if err := writeFileAtomic(filepath.Join(h.directory, entry.ID+".json"), metadata); err != nil {
+		return err
+	}
+
+	entries, err := h.entries()
+	if err != nil {
+		return err
+	}
+	for len(entries) > h.limit {
+		oldest := entries[len(entries)-1]
+		for _, ext := range []string{".json", ".rules"} {
+			if err := os.Remove(filepath.Join(h.directory, oldest.ID+ext)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		entries = entries[:len(entries)-1]
+	}
+	return nil
+}
+
+func (h *ruleHistory) list() ([]historyEntry, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.entries()
+}
+
+// entries returns all entries, newest first.
+func (h *ruleHistory) entries() ([]historyEntry, error) {
+	files, err := os.ReadDir(h.directory)
+	if os.IsNotExist(err) {
+		return []historyEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []historyEntry{}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(h.directory, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var e historyEntry
+		if err := json.Unmarshal(content, &e); err != nil {
+			return nil, fmt.Errorf("invalid history entry %s: %w", f.Name(), err)
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	return entries, nil
+}
+
+// get returns the entry with the given ID and its rules.
+func (h *ruleHistory) get(id string) (historyEntry, []byte, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	var entry historyEntry
+	if !isPlainFilename(id) {
+		return entry, nil, errHistoryNotFound
+	}
+
+	metadata, err := os.ReadFile(filepath.Join(h.directory, id+".json"))
+	if os.IsNotExist(err) {
+		return entry, nil, errHistoryNotFound
+	}
+	if err != nil {
+		return entry, nil, err
+	}
+	if err := json.Unmarshal(metadata, &entry); err != nil {
+		return entry, nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(h.directory, id+".rules"))
+	if err != nil {
+		return entry, nil, err
+	}
+	return entry, content, nil
+}
+
+// historyHandler serves the API to list, show, diff and restore
+// previously provisioned rules.
+type historyHandler struct {
+	history *ruleHistory
+	rules   *ruleProvisioningHandler
+}
+
+func (h *historyHandler) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/rules/history", h.list)
+	mux.HandleFunc("GET /api/v1/rules/history/diff", h.diff)
+	mux.HandleFunc("GET /api/v1/rules/history/{id}", h.show)
+	mux.HandleFunc("POST /api/v1/rules/history/{id}/restore", h.restore)
+}
+
+func (h *historyHandler) list(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.history.list()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		filtered := []historyEntry{}
+		for _, e := range entries {
+			if e.Namespace == namespace {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func (h *historyHandler) show(w http.ResponseWriter, r *http.Request) {
+	_, content, ok := h.getEntry(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(content)
+}
+
+// diff writes a unified diff between the from and to entries.
+// If to is not given, from is compared to the latest entry.
+func (h *historyHandler) diff(w http.ResponseWriter, r *http.Request) {
+	fromID, toID := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if fromID == "" {
+		http.Error(w, "Bad request: from parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	from, fromContent, ok := h.getEntry(w, fromID)
+	if !ok {
+		return
+	}
+
+	if toID == "" {
+		entries, err := h.history.list()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, e := range entries {
+			if e.Namespace == from.Namespace {
+				toID = e.ID
+				break
+			}
+		}
+	}
+	to, toContent, ok := h.getEntry(w, toID)
+	if !ok {
+		return
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(fromContent)),
+		B:        difflib.SplitLines(string(toContent)),
+		FromFile: from.ID,
+		FromDate: from.Timestamp.Format(time.RFC3339),
+		ToFile:   to.ID,
+		ToDate:   to.Timestamp.Format(time.RFC3339),
+		Context:  3,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(diff))
+}
+
+// restore provisions the rules of an entry again, which records
+// them as a new entry.
+func (h *historyHandler) restore(w http.ResponseWriter, r *http.Request) {
+	entry, content, ok := h.getEntry(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	h.rules.apply(w, r, entry.Namespace, content)
+}
+
+// getEntry returns the entry and its rules, or writes the error to w.
+func (h *historyHandler) getEntry(w http.ResponseWriter, id string) (historyEntry, []byte, bool) {
+	entry, content, err := h.history.get(strings.TrimSpace(id))
+	if errors.Is(err, errHistoryNotFound) {
+		http.Error(w, fmt.Sprintf("Not Found: no history entry %q", id), http.StatusNotFound)
+		return entry, nil, false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+		return entry, nil, false
+	}
+	return entry, content, true
+}
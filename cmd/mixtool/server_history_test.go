@@ -0,0 +1,143 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryRuleProvisioner keeps the last provisioned rules per namespace.
+type memoryRuleProvisioner map[string][]byte
+
+func (p memoryRuleProvisioner) provision(_ context.Context, namespace string, content []byte) (bool, error) {
+	if bytes.Equal(p[namespace], content) {
+		return false, nil
+	}
+	p[namespace] = content
+	return true, nil
+}
+
+func (p memoryRuleProvisioner) current(_ context.Context, namespace string) ([]rulefmt.RuleGroup, error) {
+	groups, errs := rulefmt.Parse(p[namespace])
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return groups.Groups, nil
+}
+
+func TestRuleHistory(t *testing.T) {
+	provisioner := memoryRuleProvisioner{}
+	rules := &ruleProvisioningHandler{
+		ruleProvisioner: provisioner,
+		history:         &ruleHistory{directory: t.TempDir(), limit: 2},
+		metrics:         newServerMetrics(),
+		logger:          log.NewNopLogger(),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/rules", rules)
+	(&historyHandler{history: rules.history, rules: rules}).register(mux)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("alice", "secret")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func() []historyEntry {
+		rec := do("GET", "/api/v1/rules/history", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var entries []historyEntry
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+		return entries
+	}
+
+	for _, content := range []string{"a: 1\n", "a: 2\n", "a: 2\n", "a: 3\n"} {
+		assert.Equal(t, http.StatusOK, do("PUT", "/api/v1/rules?namespace=ns", content).Code)
+	}
+
+	// Unchanged rules are not recorded and only the latest two are kept.
+	entries := list()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "ns", entries[0].Namespace)
+	assert.Equal(t, "alice", entries[0].Client)
+
+	rec := do("GET", "/api/v1/rules/history/"+entries[1].ID, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "a: 2\n", rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, do("GET", "/api/v1/rules/history/missing", "").Code)
+
+	rec = do("GET", "/api/v1/rules/history/diff?from="+entries[1].ID, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "-a: 2\n+a: 3\n")
+
+	assert.Equal(t, http.StatusOK, do("POST", "/api/v1/rules/history/"+entries[1].ID+"/restore", "").Code)
+	assert.Equal(t, "a: 2\n", string(provisioner["ns"]))
+
+	restored := list()
+	assert.Len(t, restored, 2)
+	assert.Equal(t, entries[1].SHA256, restored[0].SHA256)
+	assert.Equal(t, entries[0].ID, restored[1].ID)
+}
+
+func TestRuleHistoryBearerToken(t *testing.T) {
+	provisioner := memoryRuleProvisioner{}
+	rules := &ruleProvisioningHandler{
+		ruleProvisioner: provisioner,
+		history:         &ruleHistory{directory: t.TempDir(), limit: 2},
+		metrics:         newServerMetrics(),
+		logger:          log.NewNopLogger(),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/rules", rules)
+	(&historyHandler{history: rules.history, rules: rules}).register(mux)
+	handler := &bearerTokenHandler{token: "secret", handler: mux}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, content := range []string{"a: 1\n", "a: 2\n"} {
+		assert.Equal(t, http.StatusOK, do("PUT", "/api/v1/rules?namespace=ns", content).Code)
+	}
+	var entries []historyEntry
+	assert.NoError(t, json.Unmarshal(do("GET", "/api/v1/rules/history", "").Body.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "bearer-token", entries[0].Client)
+
+	assert.Equal(t, http.StatusOK, do("POST", "/api/v1/rules/history/"+entries[1].ID+"/restore", "").Code)
+	assert.NoError(t, json.Unmarshal(do("GET", "/api/v1/rules/history", "").Body.Bytes(), &entries))
+	assert.Equal(t, "bearer-token", entries[0].Client)
+	assert.Equal(t, "a: 1\n", string(provisioner["ns"]))
+
+	// Without any authentication, the client is identified by its address.
+	req := httptest.NewRequest("POST", "/", nil)
+	assert.Equal(t, req.RemoteAddr, clientIdentity(req))
+}
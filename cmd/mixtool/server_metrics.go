@@ -0,0 +1,192 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/prometheus/model/rulefmt"
+)
+
+// Results of a rule provisioning request or sync, used as the "result" label.
+const (
+	provisionResultUpdated   = "updated"
+	provisionResultUnchanged = "unchanged"
+	provisionResultRejected  = "rejected"
+	provisionResultError     = "error"
+)
+
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	provisionRequests          *prometheus.CounterVec
+	dashboardProvisionRequests *prometheus.CounterVec
+	reloads                    prometheus.Counter
+	reloadFailures             prometheus.Counter
+	reloadDuration             prometheus.Histogram
+	lastProvisionTimestamp     prometheus.Gauge
+	ruleFileSize               prometheus.Gauge
+	ruleGroups                 prometheus.Gauge
+	rules                      prometheus.Gauge
+	configReloadSuccess        prometheus.Gauge
+	configReloadTimestamp      prometheus.Gauge
+	syncs                      *prometheus.CounterVec
+	lastSyncTimestamp          prometheus.Gauge
+}
+
+func newServerMetrics() *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		provisionRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mixtool_server_provision_requests_total",
+			Help: "Total number of rule provisioning requests by result.",
+		}, []string{"result"}),
+		dashboardProvisionRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mixtool_server_dashboard_provision_requests_total",
+			Help: "Total number of dashboard provisioning requests by result.",
+		}, []string{"result"}),
+		reloads: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mixtool_server_reloads_total",
+			Help: "Total number of attempted reloads after provisioning rules.",
+		}),
+		reloadFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mixtool_server_reload_failures_total",
+			Help: "Total number of failed reloads after provisioning rules.",
+		}),
+		reloadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "mixtool_server_reload_duration_seconds",
+			Help:    "Duration of reloads after provisioning rules.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		lastProvisionTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mixtool_server_last_provision_success_timestamp_seconds",
+			Help: "Timestamp of the last successful rule provisioning.",
+		}),
+		ruleFileSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mixtool_server_rule_file_size_bytes",
+			Help: "Size of the currently provisioned rule file.",
+		}),
+		ruleGroups: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mixtool_server_rule_groups",
+			Help: "Number of rule groups in the currently provisioned rule file.",
+		}),
+		rules: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mixtool_server_rules",
+			Help: "Number of alerting and recording rules in the currently provisioned rule file.",
+		}),
+		configReloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mixtool_server_config_last_reload_successful",
+			Help: "Whether the last configuration reload attempt was successful.",
+		}),
+		configReloadTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mixtool_server_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful configuration reload.",
+		}),
+		syncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mixtool_server_syncs_total",
+			Help: "Total number of evaluations of the synced mixins by result.",
+		}, []string{"result"}),
+		lastSyncTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mixtool_server_last_sync_success_timestamp_seconds",
+			Help: "Timestamp of the last successful evaluation and provisioning of the synced mixins.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.provisionRequests,
+		m.dashboardProvisionRequests,
+		m.reloads,
+		m.reloadFailures,
+		m.reloadDuration,
+		m.lastProvisionTimestamp,
+		m.ruleFileSize,
+		m.ruleGroups,
+		m.rules,
+		m.configReloadSuccess,
+		m.configReloadTimestamp,
+		m.syncs,
+		m.lastSyncTimestamp,
+	)
+
+	// Initialize all results so that rate() works from the first request on.
+	for _, result := range []string{provisionResultUpdated, provisionResultUnchanged, provisionResultRejected, provisionResultError} {
+		m.provisionRequests.WithLabelValues(result)
+		m.dashboardProvisionRequests.WithLabelValues(result)
+	}
+	for _, result := range []string{provisionResultUpdated, provisionResultUnchanged, provisionResultError} {
+		m.syncs.WithLabelValues(result)
+	}
+
+	return m
+}
+
+// updateRules sets the rule file gauges from the provisioned rules.
+func (m *serverMetrics) updateRules(content []byte) error {
+	m.ruleFileSize.Set(float64(len(content)))
+
+	groups, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to parse rules: %w", errs[0])
+	}
+
+	rules := 0
+	for _, g := range groups.Groups {
+		rules += len(g.Rules)
+	}
+	m.ruleGroups.Set(float64(len(groups.Groups)))
+	m.rules.Set(float64(rules))
+	return nil
+}
+
+// healthyHandler reports that the server is up.
+func healthyHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(w, "mixtool server is Healthy.")
+}
+
+// readyHandler reports whether the server is able to provision rules,
+// which requires the directory of the rule file, if any, to be writable.
+// The rule file itself only exists once rules have been provisioned.
+type readyHandler struct {
+	ruleFile string
+}
+
+func (h *readyHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if h.ruleFile == "" {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "mixtool server is Ready.")
+		return
+	}
+
+	// The rule file is replaced atomically by a temporary file created
+	// next to it, which has to be possible.
+	f, err := os.CreateTemp(filepath.Dir(h.ruleFile), "temp-mixtool-ready")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Service Unavailable: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintln(w, "mixtool server is Ready.")
+}
@@ -0,0 +1,463 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"gopkg.in/yaml.v3"
+)
+
+type ruleProvisioningHandler struct {
+	ruleProvisioner ruleProvisioner
+	// reloader is nil for provisioners whose targets pick up changes by themselves.
+	reloader         reloader
+	defaultNamespace string
+	// history is nil if provisioned rules are not recorded.
+	history *ruleHistory
+	metrics *serverMetrics
+	logger  log.Logger
+
+	// mtx serializes provisioning by requests and the syncer.
+	mtx sync.Mutex
+	// reloadPending is set while the targets have not been reloaded
+	// successfully since the rules changed.
+	reloadPending bool
+}
+
+func (h *ruleProvisioningHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		h.metrics.provisionRequests.WithLabelValues(provisionResultRejected).Inc()
+		http.Error(w, "Bad request: only PUT requests supported", http.StatusBadRequest)
+		return
+	}
+
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.metrics.provisionRequests.WithLabelValues(provisionResultRejected).Inc()
+			http.Error(w, fmt.Sprintf("Request Entity Too Large: rules exceed %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.metrics.provisionRequests.WithLabelValues(provisionResultError).Inc()
+		http.Error(w, fmt.Sprintf("Internal Server Error: unable to read new rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		namespace = h.defaultNamespace
+	}
+
+	if d := r.URL.Query().Get("dry_run"); d != "" {
+		dryRun, err := strconv.ParseBool(d)
+		if err != nil {
+			h.metrics.provisionRequests.WithLabelValues(provisionResultRejected).Inc()
+			http.Error(w, fmt.Sprintf("Bad request: invalid dry_run parameter: %v", err), http.StatusBadRequest)
+			return
+		}
+		if dryRun {
+			h.diff(w, r, namespace, content)
+			return
+		}
+	}
+
+	h.apply(w, r, namespace, content)
+}
+
+// diff validates content and responds with the difference to the rules
+// currently provisioned into namespace, without changing them. Only
+// requests that fail are counted, as nothing is provisioned.
+func (h *ruleProvisioningHandler) diff(w http.ResponseWriter, r *http.Request, namespace string, content []byte) {
+	groups, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		h.metrics.provisionRequests.WithLabelValues(provisionResultRejected).Inc()
+		http.Error(w, fmt.Sprintf("Bad request: %v: %v", errInvalidRules, errors.Join(errs...)), http.StatusBadRequest)
+		return
+	}
+
+	current, err := h.ruleProvisioner.current(r.Context(), namespace)
+	if err != nil {
+		h.metrics.provisionRequests.WithLabelValues(provisionResultError).Inc()
+		http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(mixer.DiffRules(current, groups.Groups))
+}
+
+// apply provisions content into namespace on behalf of the client sending r.
+func (h *ruleProvisioningHandler) apply(w http.ResponseWriter, r *http.Request, namespace string, content []byte) {
+	changed, err := h.provision(r.Context(), namespace, content, clientIdentity(r), r.RemoteAddr)
+	if errors.Is(err, errInvalidRules) {
+		h.metrics.provisionRequests.WithLabelValues(provisionResultRejected).Inc()
+		http.Error(w, fmt.Sprintf("Bad request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.metrics.provisionRequests.WithLabelValues(provisionResultError).Inc()
+		http.Error(w, fmt.Sprintf("Internal Server Error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if changed {
+		h.metrics.provisionRequests.WithLabelValues(provisionResultUpdated).Inc()
+	} else {
+		h.metrics.provisionRequests.WithLabelValues(provisionResultUnchanged).Inc()
+	}
+}
+
+// provision provisions content into namespace, records it in the history
+// and reloads the targets if the rules changed, or if reloading them failed
+// before. client and remoteAddr identify who sent the rules. It returns
+// whether the rules changed.
+func (h *ruleProvisioningHandler) provision(ctx context.Context, namespace string, content []byte, client, remoteAddr string) (bool, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	changed, err := h.ruleProvisioner.provision(ctx, namespace, content)
+	if err != nil {
+		return false, err
+	}
+
+	if changed {
+		if err := h.metrics.updateRules(content); err != nil {
+			_ = h.logger.Log("msg", "Unable to parse provisioned rules", "err", err)
+		}
+
+		entry := newHistoryEntry(namespace, content, client, remoteAddr)
+		_ = h.logger.Log("msg", "Provisioned rules", "namespace", namespace, "sha256", entry.SHA256, "client", entry.Client, "remote_addr", entry.RemoteAddr)
+		if h.history != nil {
+			if err := h.history.add(entry, content); err != nil {
+				_ = h.logger.Log("msg", "Unable to record rules in history", "err", err)
+			}
+		}
+	}
+
+	if h.reloader == nil || !changed && !h.reloadPending {
+		h.metrics.lastProvisionTimestamp.SetToCurrentTime()
+		return changed, nil
+	}
+
+	// The rules are already in place, so a failed reload has to be
+	// retried even if the next rules are unchanged.
+	h.reloadPending = true
+	h.metrics.reloads.Inc()
+	timer := prometheus.NewTimer(h.metrics.reloadDuration)
+	err = h.reloader.triggerReload(ctx)
+	timer.ObserveDuration()
+	if err != nil {
+		h.metrics.reloadFailures.Inc()
+		return changed, err
+	}
+	h.reloadPending = false
+
+	h.metrics.lastProvisionTimestamp.SetToCurrentTime()
+	return changed, nil
+}
+
+// ruleProvisioner provisions Prometheus rules.
+type ruleProvisioner interface {
+	// provision provisions the rules in content into namespace, for
+	// provisioners that support namespaces. It returns whether the
+	// provisioned rules have changed.
+	provision(ctx context.Context, namespace string, content []byte) (bool, error)
+	// current returns the rule groups currently provisioned into namespace.
+	current(ctx context.Context, namespace string) ([]rulefmt.RuleGroup, error)
+}
+
+// errInvalidRules is returned for rules that fail validation.
+var errInvalidRules = errors.New("invalid rules")
+
+// fileRuleProvisioner provisions rules into a local rule file.
+type fileRuleProvisioner struct {
+	ruleFile string
+}
+
+// provision writes the rules in newData to the rule file in canonical form,
+// unless they are semantically equal to the existing rules. It returns
+// whether the rules changed and the targets should be reloaded.
+func (p *fileRuleProvisioner) provision(_ context.Context, _ string, newData []byte) (bool, error) {
+	canonical, err := mixer.CanonicalRules(newData)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errInvalidRules, err)
+	}
+
+	existing, err := os.ReadFile(p.ruleFile)
+	switch {
+	case err == nil:
+		// Existing rules that fail to parse are replaced.
+		if current, err := mixer.CanonicalRules(existing); err == nil && bytes.Equal(current, canonical) {
+			return false, nil
+		}
+	case !os.IsNotExist(err):
+		return false, fmt.Errorf("unable to read existing rules: %w", err)
+	}
+
+	if err := writeFileAtomic(p.ruleFile, canonical); err != nil {
+		return false, fmt.Errorf("unable to write rules: %w", err)
+	}
+	return true, nil
+}
+
+func (p *fileRuleProvisioner) current(_ context.Context, _ string) ([]rulefmt.RuleGroup, error) {
+	groups, errs := rulefmt.ParseFile(p.ruleFile)
+	if len(errs) > 0 {
+		if _, err := os.Stat(p.ruleFile); os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("invalid existing rules: %w", errors.Join(errs...))
+	}
+	return groups.Groups, nil
+}
+
+// rulerProvisioner pushes rule groups to the ruler API of Mimir or Cortex,
+// which picks up changes without being reloaded.
+type rulerProvisioner struct {
+	url       string
+	apiPrefix string
+	tenantID  string
+	client    *http.Client
+}
+
+func newRulerProvisioner(rulerURL, apiPrefix, tenantID string) *rulerProvisioner {
+	return &rulerProvisioner{
+		url:       rulerURL,
+		apiPrefix: apiPrefix,
+		tenantID:  tenantID,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// provision makes the rule groups in namespace match content, by creating
+// and updating changed groups and deleting groups no longer present.
+func (p *rulerProvisioner) provision(ctx context.Context, namespace string, content []byte) (bool, error) {
+	if namespace == "" {
+		return false, fmt.Errorf("no ruler namespace given")
+	}
+
+	groups, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		return false, fmt.Errorf("%w: %w", errInvalidRules, errors.Join(errs...))
+	}
+
+	existing, err := p.groups(ctx, namespace)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, g := range groups.Groups {
+		if old, ok := existing[g.Name]; ok && mixer.RuleGroupsEqual(old, g) {
+			continue
+		}
+		body, err := yaml.Marshal(g)
+		if err != nil {
+			return false, err
+		}
+		if err := p.do(ctx, "POST", []string{namespace}, body, nil); err != nil {
+			return false, fmt.Errorf("unable to push rule group %s: %w", g.Name, err)
+		}
+		changed = true
+	}
+
+	for name := range existing {
+		if containsGroup(groups.Groups, name) {
+			continue
+		}
+		if err := p.do(ctx, "DELETE", []string{namespace, name}, nil, nil); err != nil {
+			return false, fmt.Errorf("unable to delete rule group %s: %w", name, err)
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+func (p *rulerProvisioner) current(ctx context.Context, namespace string) ([]rulefmt.RuleGroup, error) {
+	existing, err := p.groups(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]rulefmt.RuleGroup, 0, len(existing))
+	for _, g := range existing {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// groups returns the rule groups currently in namespace by name.
+func (p *rulerProvisioner) groups(ctx context.Context, namespace string) (map[string]rulefmt.RuleGroup, error) {
+	var namespaces map[string][]rulefmt.RuleGroup
+	if err := p.do(ctx, "GET", []string{namespace}, nil, &namespaces); err != nil {
+		if errors.Is(err, errRulerNotFound) {
+			return map[string]rulefmt.RuleGroup{}, nil
+		}
+		return nil, fmt.Errorf("unable to get rule groups: %w", err)
+	}
+
+	groups := map[string]rulefmt.RuleGroup{}
+	for _, g := range namespaces[namespace] {
+		groups[g.Name] = g
+	}
+	return groups, nil
+}
+
+var errRulerNotFound = errors.New("not found")
+
+// do sends a request to the ruler API path made of the escaped segments and
+// decodes the YAML response into out, if given.
+func (p *rulerProvisioner) do(ctx context.Context, method string, segments []string, body []byte, out interface{}) error {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return err
+	}
+	// JoinPath expects escaped elements, so that group names
+	// containing slashes stay a single path segment.
+	elems := []string{p.apiPrefix}
+	for _, s := range segments {
+		elems = append(elems, url.PathEscape(s))
+	}
+	u = u.JoinPath(elems...)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	if p.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", p.tenantID)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errRulerNotFound
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("received %s response: %s", resp.Status, bytes.TrimSpace(respBody))
+	case out != nil:
+		return yaml.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+func containsGroup(groups []rulefmt.RuleGroup, name string) bool {
+	for _, g := range groups {
+		if g.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reloader reloads a target after its rules have been provisioned.
+type reloader interface {
+	triggerReload(ctx context.Context) error
+}
+
+type prometheusReloader struct {
+	prometheusReloadURL string
+}
+
+func (r *prometheusReloader) triggerReload(ctx context.Context) error {
+	resp, err := postReload(ctx, r.prometheusReloadURL)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("received non-200 response: %s; have you set `--web.enable-lifecycle` Prometheus flag?", resp.Status)
+	}
+	return nil
+}
+
+type thanosRulerReloader struct {
+	reloadURL string
+}
+
+func (r *thanosRulerReloader) triggerReload(ctx context.Context) error {
+	resp, err := postReload(ctx, r.reloadURL)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("received non-200 response from Thanos Ruler: %s", resp.Status)
+	}
+	return nil
+}
+
+// postReload sends a reload request to reloadURL and exhausts the response body.
+func postReload(ctx context.Context, reloadURL string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", reloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reload request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return nil, fmt.Errorf("exhausting request body: %w", err)
+	}
+	return resp, nil
+}
+
+// multiReloader reloads all of its targets, even if some of them fail.
+type multiReloader []reloader
+
+func (m multiReloader) triggerReload(ctx context.Context) error {
+	var errs []error
+	for _, r := range m {
+		if err := r.triggerReload(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,289 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeRuler implements the Mimir ruler configuration API for a single tenant.
+type fakeRuler struct {
+	mtx        sync.Mutex
+	namespaces map[string]map[string]rulefmt.RuleGroup
+	requests   []string
+}
+
+func (f *fakeRuler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if r.Header.Get("X-Scope-OrgID") != "team-a" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/prometheus/config/v1/rules/"), "/")
+	for i := range segments {
+		segments[i], _ = url.PathUnescape(segments[i])
+	}
+	namespace := segments[0]
+	f.requests = append(f.requests, r.Method+" "+r.URL.EscapedPath())
+
+	switch {
+	case r.Method == "GET" && len(segments) == 1:
+		groups, ok := f.namespaces[namespace]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		out := map[string][]rulefmt.RuleGroup{}
+		for _, g := range groups {
+			out[namespace] = append(out[namespace], g)
+		}
+		_ = yaml.NewEncoder(w).Encode(out)
+	case r.Method == "POST" && len(segments) == 1:
+		body, _ := io.ReadAll(r.Body)
+		var g rulefmt.RuleGroup
+		if err := yaml.Unmarshal(body, &g); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if f.namespaces[namespace] == nil {
+			f.namespaces[namespace] = map[string]rulefmt.RuleGroup{}
+		}
+		f.namespaces[namespace][g.Name] = g
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == "DELETE" && len(segments) == 2:
+		delete(f.namespaces[namespace], segments[1])
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestRulerProvisioner(t *testing.T) {
+	ruler := &fakeRuler{namespaces: map[string]map[string]rulefmt.RuleGroup{}}
+	ts := httptest.NewServer(ruler)
+	defer ts.Close()
+
+	p := newRulerProvisioner(ts.URL, "/prometheus/config/v1/rules", "team-a")
+	ctx := context.Background()
+
+	rules := `groups:
+- name: a
+  rules:
+  - alert: A
+    expr: up == 0
+- name: b/c
+  rules:
+  - record: b
+    expr: sum(up)
+`
+	changed, err := p.provision(ctx, "kubernetes", []byte(rules))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, ruler.namespaces["kubernetes"], 2)
+
+	// The same rules in JSON are not pushed again.
+	ruler.requests = nil
+	changed, err = p.provision(ctx, "kubernetes", []byte(`{"groups":[{"name":"a","rules":[{"alert":"A","expr":"up == 0"}]},{"name":"b/c","rules":[{"record":"b","expr":"sum(up)"}]}]}`))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, []string{"GET /prometheus/config/v1/rules/kubernetes"}, ruler.requests)
+
+	// Removed groups are deleted.
+	ruler.requests = nil
+	changed, err = p.provision(ctx, "kubernetes", []byte("groups:\n- name: a\n  rules:\n  - alert: A\n    expr: up == 1\n"))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, ruler.requests, "DELETE /prometheus/config/v1/rules/kubernetes/b%2Fc")
+	assert.Len(t, ruler.namespaces["kubernetes"], 1)
+	assert.Equal(t, "up == 1", ruler.namespaces["kubernetes"]["a"].Rules[0].Expr.Value)
+
+	_, err = p.provision(ctx, "kubernetes", []byte("groups:\n- name: a\n  rules:\n  - alert: A\n    expr: up ==\n"))
+	assert.Error(t, err)
+}
+
+func TestMultiReloader(t *testing.T) {
+	var mtx sync.Mutex
+	reloads := 0
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		reloads++
+		mtx.Unlock()
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	r := multiReloader{
+		&prometheusReloader{prometheusReloadURL: ok.URL + "/-/reload"},
+		&thanosRulerReloader{reloadURL: failing.URL + "/-/reload"},
+		&thanosRulerReloader{reloadURL: ok.URL + "/-/reload"},
+	}
+	err := r.triggerReload(context.Background())
+	assert.ErrorContains(t, err, "Thanos Ruler: 403 Forbidden")
+	assert.Equal(t, 2, reloads)
+}
+
+func TestRuleProvisioningDryRun(t *testing.T) {
+	ruleFile := filepath.Join(t.TempDir(), "rules.yaml")
+	current := "groups:\n- name: g\n  rules:\n  - {record: a, expr: vector(1)}\n"
+	assert.NoError(t, os.WriteFile(ruleFile, []byte(current), 0644))
+
+	h := &ruleProvisioningHandler{
+		ruleProvisioner: &fileRuleProvisioner{ruleFile: ruleFile},
+		reloader:        multiReloader{},
+		metrics:         newServerMetrics(),
+		logger:          log.NewNopLogger(),
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/v1/rules?dry_run=true", strings.NewReader("groups:\n- name: g\n  rules:\n  - {record: b, expr: vector(1)}\n")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var diff mixer.RulesDiff
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &diff))
+	assert.Equal(t, mixer.RulesDiff{ChangedGroups: []mixer.GroupDiff{{
+		Name:         "g",
+		AddedRules:   []string{"record b"},
+		RemovedRules: []string{"record a"},
+	}}}, diff)
+
+	content, err := os.ReadFile(ruleFile)
+	assert.NoError(t, err)
+	assert.Equal(t, current, string(content), "dry run must not change the rules")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/v1/rules?dry_run=true", strings.NewReader("groups:\n- name: g\n  rules:\n  - {record: b}\n")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(h.metrics.provisionRequests.WithLabelValues(provisionResultRejected)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(h.metrics.provisionRequests.WithLabelValues(provisionResultUpdated)))
+}
+
+// failingReloader fails the first failures reloads.
+type failingReloader struct {
+	failures int
+	reloads  int
+}
+
+func (r *failingReloader) triggerReload(context.Context) error {
+	r.reloads++
+	if r.reloads <= r.failures {
+		return errors.New("reload failed")
+	}
+	return nil
+}
+
+func TestRuleProvisioningRetriesReload(t *testing.T) {
+	reloader := &failingReloader{failures: 1}
+	h := &ruleProvisioningHandler{
+		ruleProvisioner: &fileRuleProvisioner{ruleFile: filepath.Join(t.TempDir(), "rules.yaml")},
+		reloader:        reloader,
+		metrics:         newServerMetrics(),
+		logger:          log.NewNopLogger(),
+	}
+	ctx := context.Background()
+	content := []byte("groups:\n- name: g\n  rules:\n  - {record: a, expr: vector(1)}\n")
+
+	changed, err := h.provision(ctx, "", content, "", "")
+	assert.Error(t, err)
+	assert.True(t, changed)
+
+	// The rules are unchanged, but the failed reload is retried.
+	changed, err = h.provision(ctx, "", content, "", "")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 2, reloader.reloads)
+
+	changed, err = h.provision(ctx, "", content, "", "")
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 2, reloader.reloads)
+}
+
+func TestRuleProvisioningConcurrent(t *testing.T) {
+	reloader := &failingReloader{}
+	h := &ruleProvisioningHandler{
+		ruleProvisioner: &fileRuleProvisioner{ruleFile: filepath.Join(t.TempDir(), "rules.yaml")},
+		reloader:        reloader,
+		metrics:         newServerMetrics(),
+		logger:          log.NewNopLogger(),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			content := fmt.Sprintf("groups:\n- name: g\n  rules:\n  - {record: a, expr: vector(%d)}\n", i)
+			_, err := h.provision(context.Background(), "", []byte(content), "", "")
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 10, reloader.reloads)
+}
+
+func TestFileRuleProvisioner(t *testing.T) {
+	ruleFile := filepath.Join(t.TempDir(), "rules.yaml")
+	p := &fileRuleProvisioner{ruleFile: ruleFile}
+	ctx := context.Background()
+
+	changed, err := p.provision(ctx, "", []byte("groups:\n- name: g\n  rules:\n  - record: a\n    expr: |\n      vector(1)\n"))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	content, err := os.ReadFile(ruleFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "groups:\n  - name: g\n    rules:\n      - record: a\n        expr: vector(1)\n", string(content))
+
+	// Differently formatted but equal rules are not written again.
+	changed, err = p.provision(ctx, "", []byte(`{"groups": [{"name": "g", "rules": [{"expr": "vector(1)", "record": "a"}]}]}`))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = p.provision(ctx, "", []byte("groups:\n- name: g\n  rules:\n  - record: a\n    expr: vector(2)\n"))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	_, err = p.provision(ctx, "", []byte("groups:\n- name: g\n  rules:\n  - record: a\n"))
+	assert.ErrorIs(t, err, errInvalidRules)
+
+	files, err := os.ReadDir(filepath.Dir(ruleFile))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "no temporary files must be left behind")
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/monitoring-mixins/mixtool/pkg/jsonnetbundler"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"gopkg.in/yaml.v3"
+)
+
+// syncClient identifies rules provisioned by the syncer in logs and the history.
+const syncClient = "mixtool-sync"
+
+// ruleSyncer periodically evaluates mixins and provisions their rules,
+// which only reloads the targets if the rules changed.
+type ruleSyncer struct {
+	mixins   []syncMixin
+	interval time.Duration
+	// namespaced is set for provisioners keeping the rules of each
+	// namespace apart, all rules are combined otherwise.
+	namespaced bool
+	rules      *ruleProvisioningHandler
+	metrics    *serverMetrics
+	logger     log.Logger
+}
+
+// run syncs right away and then every interval until ctx is done.
+func (s *ruleSyncer) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sync(ctx); err != nil {
+			_ = s.logger.Log("msg", "Unable to sync mixins", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync evaluates the mixins and provisions the rules of every namespace
+// whose mixins all evaluated successfully.
+func (s *ruleSyncer) sync(ctx context.Context) error {
+	namespaces := map[string][]rulefmt.RuleGroup{}
+	failed := map[string]bool{}
+	var errs []error
+
+	for _, m := range s.mixins {
+		namespace := s.namespace(m)
+		groups, err := evaluateSyncMixin(m)
+		if err != nil {
+			failed[namespace] = true
+			errs = append(errs, fmt.Errorf("mixin %s: %w", m.Name, err))
+			continue
+		}
+		namespaces[namespace] = append(namespaces[namespace], groups...)
+	}
+
+	names := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		names = append(names, namespace)
+	}
+	sort.Strings(names)
+
+	changed := false
+	for _, namespace := range names {
+		if failed[namespace] {
+			continue
+		}
+		content, err := marshalRuleGroups(namespaces[namespace])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("namespace %q: %w", namespace, err))
+			continue
+		}
+		c, err := s.rules.provision(ctx, namespace, content, syncClient, "")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("namespace %q: %w", namespace, err))
+			continue
+		}
+		changed = changed || c
+	}
+
+	switch {
+	case len(errs) > 0:
+		s.metrics.syncs.WithLabelValues(provisionResultError).Inc()
+		return errors.Join(errs...)
+	case changed:
+		s.metrics.syncs.WithLabelValues(provisionResultUpdated).Inc()
+	default:
+		s.metrics.syncs.WithLabelValues(provisionResultUnchanged).Inc()
+	}
+	s.metrics.lastSyncTimestamp.SetToCurrentTime()
+	return nil
+}
+
+func (s *ruleSyncer) namespace(m syncMixin) string {
+	switch {
+	case !s.namespaced:
+		return ""
+	case m.Namespace != "":
+		return m.Namespace
+	}
+	return m.Name
+}
+
+// evaluateSyncMixin installs the dependencies of m, if it is part of
+// a jsonnet-bundler project, and returns the rule groups it generates.
+func evaluateSyncMixin(m syncMixin) ([]rulefmt.RuleGroup, error) {
+	jpaths := m.JPaths
+	if m.JsonnetfileDir != "" {
+		var err error
+		if m.Update {
+			err = jsonnetbundler.UpdateCommand(m.JsonnetfileDir, "vendor")
+		} else {
+			err = jsonnetbundler.InstallCommand(m.JsonnetfileDir, "vendor", nil, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(jpaths) == 0 {
+			jpaths = []string{filepath.Join(m.JsonnetfileDir, "vendor")}
+		}
+	}
+
+	content, err := mixer.GenerateRulesAlerts(m.File, mixer.GenerateOptions{JPaths: jpaths, YAML: true})
+	if err != nil {
+		return nil, err
+	}
+
+	groups, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid rules: %w", errors.Join(errs...))
+	}
+	return groups.Groups, nil
+}
+
+// marshalRuleGroups returns the rule file made of groups, which is
+// rejected if groups of different mixins share a name.
+func marshalRuleGroups(groups []rulefmt.RuleGroup) ([]byte, error) {
+	content, err := yaml.Marshal(rulefmt.RuleGroups{Groups: groups})
+	if err != nil {
+		return nil, err
+	}
+	if _, errs := rulefmt.Parse(content); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid rules: %w", errors.Join(errs...))
+	}
+	return content, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeSyncMixin(t *testing.T, filename, alert string) {
+	mixin := `{
+  prometheusAlerts+:: {
+    groups+: [{
+      name: '` + alert + `',
+      rules: [{ alert: '` + alert + `', expr: 'vector(1)' }],
+    }],
+  },
+}
+`
+	assert.NoError(t, os.WriteFile(filename, []byte(mixin), 0644))
+}
+
+func TestRuleSyncer(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.libsonnet"), filepath.Join(dir, "b.libsonnet")
+	writeSyncMixin(t, a, "A")
+	writeSyncMixin(t, b, "B")
+
+	provisioner := memoryRuleProvisioner{}
+	metrics := newServerMetrics()
+	s := &ruleSyncer{
+		mixins: []syncMixin{{Name: "a", File: a}, {Name: "b", File: b, Namespace: "other"}},
+		rules: &ruleProvisioningHandler{
+			ruleProvisioner: provisioner,
+			metrics:         metrics,
+			logger:          log.NewNopLogger(),
+		},
+		metrics: metrics,
+		logger:  log.NewNopLogger(),
+	}
+	ctx := context.Background()
+
+	// Without namespaces, the rules of all mixins are combined.
+	assert.NoError(t, s.sync(ctx))
+	groups, err := provisioner.current(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	assert.NoError(t, s.sync(ctx))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.syncs.WithLabelValues(provisionResultUpdated)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.syncs.WithLabelValues(provisionResultUnchanged)))
+
+	// Failing mixins leave the rules untouched.
+	assert.NoError(t, os.WriteFile(b, []byte("{"), 0644))
+	assert.Error(t, s.sync(ctx))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.syncs.WithLabelValues(provisionResultError)))
+	groups, err = provisioner.current(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	// With namespaces, only the namespaces of failing mixins are skipped.
+	s.namespaced = true
+	assert.Error(t, s.sync(ctx))
+	groups, err = provisioner.current(ctx, "a")
+	assert.NoError(t, err)
+	assert.Len(t, groups, 1)
+	assert.NotContains(t, provisioner, "other")
+
+	// Groups of different mixins must not share a name.
+	writeSyncMixin(t, b, "A")
+	s.namespaced = false
+	assert.Error(t, s.sync(ctx))
+}
+
+func TestSyncConfigValidate(t *testing.T) {
+	valid := syncConfig{Interval: 1, Mixins: []syncMixin{{Name: "a", File: "a.libsonnet"}}}
+	assert.NoError(t, valid.validate())
+
+	for _, c := range []syncConfig{
+		{Mixins: []syncMixin{{Name: "a", File: "a.libsonnet"}}},
+		{Interval: 1, Mixins: []syncMixin{{File: "a.libsonnet"}}},
+		{Interval: 1, Mixins: []syncMixin{{Name: "a"}}},
+		{Interval: 1, Mixins: []syncMixin{{Name: "a", File: "a"}, {Name: "a", File: "b"}}},
+		{Interval: 1, Mixins: []syncMixin{{Name: "a", File: "a", Update: true}}},
+	} {
+		assert.Error(t, c.validate())
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBearerTokenHandler(t *testing.T) {
+	h := &bearerTokenHandler{
+		token: "secret",
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+
+	for _, tc := range []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Basic c2VjcmV0", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusNoContent},
+	} {
+		req := httptest.NewRequest("PUT", "/api/v1/rules", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, tc.status, rec.Code, "Authorization: %q", tc.header)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	dir := t.TempDir()
+	for ruleFile, status := range map[string]int{
+		"":                                     http.StatusOK,
+		filepath.Join(dir, "rules.yaml"):       http.StatusOK,
+		filepath.Join(dir, "missing", "rules"): http.StatusServiceUnavailable,
+	} {
+		rec := httptest.NewRecorder()
+		(&readyHandler{ruleFile: ruleFile}).ServeHTTP(rec, httptest.NewRequest("GET", "/-/ready", nil))
+		assert.Equal(t, status, rec.Code, ruleFile)
+	}
+
+	// Checking the directory leaves nothing behind.
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestValidateWebConfig(t *testing.T) {
+	dir := t.TempDir()
+	webConfig := filepath.Join(dir, "web.yml")
+	// bcrypt hash of "password"
+	err := os.WriteFile(webConfig, []byte(`basic_auth_users:
+  admin: $2y$10$X0h1gDsPszWURQaxFh.zoubFi6DXncSjhoQNJgRrnGs7EsimhC7zG
+`), 0644)
+	assert.NoError(t, err)
+
+	assert.NoError(t, validateWebConfig("", "token"))
+	assert.NoError(t, validateWebConfig(webConfig, ""))
+	assert.Error(t, validateWebConfig(webConfig, "token"))
+	assert.Error(t, validateWebConfig(filepath.Join(dir, "missing.yml"), ""))
+}
+
+func TestServerMetricsUpdateRules(t *testing.T) {
+	content, err := os.ReadFile("rules.yaml")
+	assert.NoError(t, err)
+
+	m := newServerMetrics()
+	assert.NoError(t, m.updateRules(content))
+	assert.Equal(t, float64(len(content)), testutil.ToFloat64(m.ruleFileSize))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.ruleGroups))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.rules))
+
+	assert.Error(t, m.updateRules([]byte("groups: [")))
+}
+
+func TestServerMixin(t *testing.T) {
+	var out bytes.Buffer
+	err := mixer.Lint(&out, "../../mixin/mixin.libsonnet", mixer.LintOptions{Prometheus: true, Grafana: true})
+	assert.NoError(t, err, out.String())
+}
+
+func TestMixtoolServerMaxBodySize(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "rules.yaml")
+	assert.NoError(t, os.WriteFile(ruleFile, nil, 0644))
+
+	s := &mixtoolServer{
+		baseConfig:  serverConfig{RuleFile: ruleFile},
+		maxBodySize: 16,
+		metrics:     newServerMetrics(),
+		logger:      log.NewNopLogger(),
+	}
+	assert.NoError(t, s.reload())
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/v1/rules", strings.NewReader("groups:\n- name: too-large\n")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.provisionRequests.WithLabelValues(provisionResultRejected)))
+}
+
+func TestMixtoolServerBearerToken(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "rules.yaml")
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(ruleFile, nil, 0644))
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+
+	for _, unauthenticatedMetrics := range []bool{false, true} {
+		s := &mixtoolServer{
+			baseConfig:  serverConfig{RuleFile: ruleFile, BearerTokenFile: tokenFile, UnauthenticatedMetrics: unauthenticatedMetrics},
+			maxBodySize: 1 << 20,
+			metrics:     newServerMetrics(),
+			logger:      log.NewNopLogger(),
+		}
+		assert.NoError(t, s.reload())
+
+		metricsStatus := http.StatusUnauthorized
+		if unauthenticatedMetrics {
+			metricsStatus = http.StatusOK
+		}
+		for path, status := range map[string]int{
+			"/-/healthy":    http.StatusOK,
+			"/-/ready":      http.StatusOK,
+			"/metrics":      metricsStatus,
+			"/api/v1/rules": http.StatusUnauthorized,
+			"/-/reload":     http.StatusUnauthorized,
+		} {
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			assert.Equal(t, status, rec.Code, "GET %s with unauthenticated metrics %t", path, unauthenticatedMetrics)
+		}
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
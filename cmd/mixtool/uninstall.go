@@ -0,0 +1,58 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/monitoring-mixins/mixtool/pkg/installer"
+
+	"github.com/urfave/cli"
+)
+
+func uninstallCommand() cli.Command {
+	return cli.Command{
+		Name:        "uninstall",
+		Usage:       "Uninstall a mixin",
+		Description: "Remove an installed mixin, its vendored files and its generated alerts, rules and dashboards",
+		ArgsUsage:   "name",
+		Action:      uninstallAction,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "directory, d",
+				Usage: "Path the mixin has been installed into",
+			},
+		},
+	}
+}
+
+func uninstallAction(c *cli.Context) error {
+	directory := c.String("directory")
+	if directory == "" {
+		return fmt.Errorf("must specify the directory the mixin has been installed into")
+	}
+
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("expected the name of the mixin to uninstall")
+	}
+
+	m, err := installer.Uninstall(name, installer.Options{Directory: directory})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Uninstalled %s\n", m.Name)
+	return nil
+}
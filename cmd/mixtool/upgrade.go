@@ -0,0 +1,80 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/monitoring-mixins/mixtool/pkg/installer"
+
+	"github.com/urfave/cli"
+)
+
+func upgradeCommand() cli.Command {
+	return cli.Command{
+		Name:        "upgrade",
+		Usage:       "Upgrade installed mixins",
+		Description: "Upgrade the named mixins, or all mixins installed into the directory, to their latest version and show the changes to their alerts, rules and dashboards",
+		ArgsUsage:   "[name...]",
+		Action:      upgradeAction,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "directory, d",
+				Usage: "Path the mixins have been installed into",
+			},
+		},
+	}
+}
+
+func upgradeAction(c *cli.Context) error {
+	directory := c.String("directory")
+	if directory == "" {
+		return fmt.Errorf("must specify the directory the mixins have been installed into")
+	}
+
+	results, err := installer.Upgrade(c.Args(), installer.Options{Directory: directory})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if r.FromVersion == r.ToVersion {
+			fmt.Printf("Upgraded %s, still at %s\n", r.Mixin, formatVersion(r.ToVersion))
+		} else {
+			fmt.Printf("Upgraded %s from %s to %s\n", r.Mixin, formatVersion(r.FromVersion), formatVersion(r.ToVersion))
+		}
+		printUpgradeDiff("alerts", r.Alerts.Empty(), r.Alerts.String())
+		printUpgradeDiff("rules", r.Rules.Empty(), r.Rules.String())
+		printUpgradeDiff("dashboards", r.Dashboards.Empty(), r.Dashboards.String())
+	}
+	return nil
+}
+
+func printUpgradeDiff(kind string, empty bool, diff string) {
+	if empty {
+		fmt.Printf("No changes to %s\n", kind)
+		return
+	}
+	fmt.Printf("Changes to %s:\n%s", kind, diff)
+}
+
+// formatVersion returns version, or a placeholder for local mixins
+// without one.
+func formatVersion(version string) string {
+	if version == "" {
+		return "(local)"
+	}
+	return version
+}
@@ -0,0 +1,97 @@
+{
+  prometheusAlerts+:: {
+    groups+: [
+      {
+        name: 'mixtool-server',
+        rules: [
+          {
+            alert: 'MixtoolServerDown',
+            expr: |||
+              up{%(mixtoolServerSelector)s} == 0
+            ||| % $._config,
+            'for': '5m',
+            labels: {
+              severity: 'warning',
+            },
+            annotations: {
+              summary: 'Mixtool server is down.',
+              description: 'Mixtool server {{ $labels.instance }} has not been scraped successfully for 5 minutes.',
+            },
+          },
+          {
+            alert: 'MixtoolServerProvisioningFailing',
+            expr: |||
+              rate(mixtool_server_provision_requests_total{%(mixtoolServerSelector)s, result="error"}[5m]) > 0
+            ||| % $._config,
+            'for': '15m',
+            labels: {
+              severity: 'warning',
+            },
+            annotations: {
+              summary: 'Mixtool server fails to provision rules.',
+              description: 'Mixtool server {{ $labels.instance }} has failed {{ $value | humanize }} provisioning requests per second for 15 minutes.',
+            },
+          },
+          {
+            alert: 'MixtoolServerReloadFailing',
+            expr: |||
+              increase(mixtool_server_reload_failures_total{%(mixtoolServerSelector)s}[15m]) > 0
+            ||| % $._config,
+            labels: {
+              severity: 'warning',
+            },
+            annotations: {
+              summary: 'Mixtool server fails to reload its targets.',
+              description: 'Mixtool server {{ $labels.instance }} failed to reload its targets after provisioning rules, the new rules are not active.',
+            },
+          },
+          {
+            alert: 'MixtoolServerConfigReloadFailed',
+            expr: |||
+              mixtool_server_config_last_reload_successful{%(mixtoolServerSelector)s} == 0
+            ||| % $._config,
+            'for': '10m',
+            labels: {
+              severity: 'warning',
+            },
+            annotations: {
+              summary: 'Mixtool server configuration reload failed.',
+              description: 'Mixtool server {{ $labels.instance }} failed to reload its configuration and keeps running with the previous one.',
+            },
+          },
+          {
+            alert: 'MixtoolServerSyncFailing',
+            expr: |||
+              sum without (result) (increase(mixtool_server_syncs_total{%(mixtoolServerSelector)s, result="error"}[30m])) > 0
+              and
+              sum without (result) (increase(mixtool_server_syncs_total{%(mixtoolServerSelector)s, result!="error"}[30m])) == 0
+            ||| % $._config,
+            labels: {
+              severity: 'warning',
+            },
+            annotations: {
+              summary: 'Mixtool server fails to sync mixins.',
+              description: 'Mixtool server {{ $labels.instance }} has not evaluated and provisioned its synced mixins successfully for 30 minutes.',
+            },
+          },
+          {
+            alert: 'MixtoolServerProvisioningStale',
+            expr: |||
+              time() - mixtool_server_last_provision_success_timestamp_seconds{%(mixtoolServerSelector)s} > %(provisionStaleThresholdSeconds)d
+              and
+              mixtool_server_last_provision_success_timestamp_seconds{%(mixtoolServerSelector)s} > 0
+            ||| % $._config,
+            'for': '15m',
+            labels: {
+              severity: 'info',
+            },
+            annotations: {
+              summary: 'Mixtool server has not provisioned rules recently.',
+              description: 'Mixtool server {{ $labels.instance }} has not provisioned rules successfully for {{ $value | humanizeDuration }}.',
+            },
+          },
+        ],
+      },
+    ],
+  },
+}
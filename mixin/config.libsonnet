@@ -0,0 +1,12 @@
+{
+  _config+:: {
+    // Selector to apply to all mixtool server metrics.
+    mixtoolServerSelector: 'job="mixtool-server"',
+
+    // Alert if no rules have been provisioned successfully for this long.
+    provisionStaleThresholdSeconds: 24 * 3600,
+
+    dashboardTags: ['mixtool'],
+    dashboardRefresh: '1m',
+  },
+}
@@ -0,0 +1,107 @@
+local variable(name, label) = {
+  name: name,
+  label: label,
+  type: 'query',
+  datasource: { type: 'prometheus', uid: '${datasource}' },
+  query: { query: 'label_values(mixtool_server_provision_requests_total, %s)' % name, refId: 'StandardVariableQuery' },
+  definition: 'label_values(mixtool_server_provision_requests_total, %s)' % name,
+  refresh: 2,
+  includeAll: true,
+  multi: true,
+  allValue: '.+',
+  current: { selected: false, text: 'All', value: '$__all' },
+  hide: 0,
+  options: [],
+  regex: '',
+  sort: 1,
+};
+
+local panel(id, title, description, unit, expr, legendFormat, gridPos) = {
+  id: id,
+  title: title,
+  description: description,
+  type: 'timeseries',
+  datasource: { type: 'prometheus', uid: '${datasource}' },
+  fieldConfig: { defaults: { unit: unit }, overrides: [] },
+  gridPos: gridPos,
+  targets: [
+    {
+      datasource: { type: 'prometheus', uid: '${datasource}' },
+      expr: expr,
+      legendFormat: legendFormat,
+      refId: 'A',
+    },
+  ],
+};
+
+local selector = 'job=~"$job", instance=~"$instance"';
+
+{
+  grafanaDashboards+:: {
+    'mixtool-server.json': {
+      uid: 'mixtool-server',
+      title: 'Mixtool / Server',
+      tags: $._config.dashboardTags,
+      editable: false,
+      refresh: $._config.dashboardRefresh,
+      schemaVersion: 39,
+      time: { from: 'now-6h', to: 'now' },
+      timezone: 'utc',
+      templating: {
+        list: [
+          {
+            name: 'datasource',
+            label: 'Data source',
+            type: 'datasource',
+            query: 'prometheus',
+            current: { selected: false, text: 'default', value: 'default' },
+            hide: 0,
+            options: [],
+            refresh: 1,
+            regex: '',
+          },
+          variable('job', 'Job'),
+          variable('instance', 'Instance'),
+        ],
+      },
+      panels: [
+        panel(
+          1,
+          'Provisioning requests',
+          'Rate of rule provisioning requests by result.',
+          'reqps',
+          'sum by (result) (rate(mixtool_server_provision_requests_total{%s}[$__rate_interval]))' % selector,
+          '{{result}}',
+          { h: 8, w: 12, x: 0, y: 0 },
+        ),
+        panel(
+          2,
+          'Reload failures',
+          'Rate of failed reloads of the targets after provisioning rules.',
+          'reqps',
+          'sum(rate(mixtool_server_reload_failures_total{%s}[$__rate_interval]))' % selector,
+          'failures',
+          { h: 8, w: 12, x: 12, y: 0 },
+        ),
+        panel(
+          3,
+          'Reload latency',
+          '99th percentile latency of reloading the targets after provisioning rules.',
+          's',
+          'histogram_quantile(0.99, sum by (le) (rate(mixtool_server_reload_duration_seconds_bucket{%s}[$__rate_interval])))' % selector,
+          'p99',
+          { h: 8, w: 12, x: 0, y: 8 },
+        ),
+        panel(
+          4,
+          'Provisioned rules',
+          'Number of rules in the currently provisioned rule file.',
+          'short',
+          'sum by (instance) (mixtool_server_rules{%s})' % selector,
+          '{{instance}}',
+          { h: 8, w: 12, x: 12, y: 8 },
+        ),
+      ],
+    },
+  },
+}
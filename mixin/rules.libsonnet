@@ -0,0 +1,23 @@
+{
+  prometheusRules+:: {
+    groups+: [
+      {
+        name: 'mixtool-server.rules',
+        rules: [
+          {
+            record: 'job_result:mixtool_server_provision_requests:rate5m',
+            expr: |||
+              sum by (job, result) (rate(mixtool_server_provision_requests_total{%(mixtoolServerSelector)s}[5m]))
+            ||| % $._config,
+          },
+          {
+            record: 'job:mixtool_server_reload_duration_seconds:99quantile',
+            expr: |||
+              histogram_quantile(0.99, sum by (job, le) (rate(mixtool_server_reload_duration_seconds_bucket{%(mixtoolServerSelector)s}[5m])))
+            ||| % $._config,
+          },
+        ],
+      },
+    ],
+  },
+}
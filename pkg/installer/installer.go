@@ -0,0 +1,339 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package installer downloads mixins with jsonnet-bundler and generates
+// their alerts, rules and dashboards. Mixins are installed from git
+// repositories, local directories or tarballs. Any number of mixins can be
+// installed into the same directory, each generating its files into a
+// subdirectory named after it. All paths are resolved against the install
+// directory, the working directory of the process is never changed.
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/monitoring-mixins/mixtool/pkg/jsonnetbundler"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+// Options configures where a mixin is installed and its files are generated.
+type Options struct {
+	// Directory is the jsonnet-bundler project the mixin is installed into.
+	// It is created if it does not exist, an existing project is reused.
+	Directory string
+	// JsonnetHome is the directory dependencies are vendored into,
+	// relative to Directory. Defaults to "vendor".
+	JsonnetHome string
+	// AlertsFilename, RulesFilename and DashboardsDirectory are where the
+	// generated files are written, relative to the subdirectory of Directory
+	// named after the mixin. They default to "alerts.yaml", "rules.yaml"
+	// and "dashboards_out".
+	AlertsFilename      string
+	RulesFilename       string
+	DashboardsDirectory string
+	// Version is the git tag, branch or commit to install. The default
+	// branch is installed if it is empty.
+	Version string
+}
+
+// Result describes an installed mixin, with absolute paths.
+type Result struct {
+	MixinFile string
+	// Directory is the subdirectory the files of the mixin are generated
+	// into.
+	Directory           string
+	AlertsFile          string
+	RulesFile           string
+	DashboardsDirectory string
+	// Version is the commit the mixin has been resolved to, as recorded
+	// in the jsonnet-bundler lock file.
+	Version string
+	// RulesAlerts are the rules and alerts of the mixin in a single rule
+	// file, as provisioned by mixtool server.
+	RulesAlerts []byte
+}
+
+// Install downloads the mixin at source into opts.Directory and generates
+// its alerts, rules and dashboards. The source is a git URL, including
+// SSH URLs, a local directory or a tarball.
+func Install(source string, opts Options) (*Result, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	mixinURL, err := resolveSource(source, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOutputDirectory(mixinURL, opts); err != nil {
+		return nil, err
+	}
+
+	version, err := Download(mixinURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := Generate(mixinURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Version = version
+	return result, nil
+}
+
+// Download installs the mixin at mixinURL, a git URL or an absolute local
+// directory, into opts.Directory by running jb init and jb install.
+// It returns the commit the mixin resolved to, which is empty for local
+// directories.
+func Download(mixinURL string, opts Options) (string, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(opts.Directory, 0755); err != nil {
+		return "", fmt.Errorf("could not create directory %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(opts.Directory, jsonnetfile.File))
+	if os.IsNotExist(err) {
+		if err := jsonnetbundler.InitCommand(opts.Directory); err != nil {
+			return "", fmt.Errorf("jsonnet bundler init failed %v", err)
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	uri := mixinURL
+	if opts.Version != "" {
+		if filepath.IsAbs(mixinURL) {
+			return "", fmt.Errorf("cannot install version %s of local mixin %s", opts.Version, mixinURL)
+		}
+		uri += "@" + opts.Version
+	}
+	if err := jsonnetbundler.InstallCommand(opts.Directory, opts.JsonnetHome, []string{uri}, false); err != nil {
+		return "", fmt.Errorf("jsonnet bundler install failed %v", err)
+	}
+
+	return jsonnetbundler.LockedVersion(opts.Directory, uri)
+}
+
+// SplitVersion splits a mixin name or URL followed by @ and a version
+// into both parts. The version is empty if none is given.
+func SplitVersion(mixin string) (string, string) {
+	at := strings.LastIndex(mixin, "@")
+	if at < 0 {
+		return mixin, ""
+	}
+
+	// An @ in front of the path, like in git@github.com:org/repo.git,
+	// separates the user instead of a version.
+	start := 0
+	if i := strings.Index(mixin, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	if slash := strings.Index(mixin[start:], "/"); slash >= 0 && at < start+slash {
+		return mixin, ""
+	}
+	return mixin[:at], mixin[at+1:]
+}
+
+// Generate writes the alerts, rules and dashboards of the mixin at
+// mixinURL, which must have been downloaded into opts.Directory.
+func Generate(mixinURL string, opts Options) (*Result, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := jsonnetbundler.DependencyName(opts.Directory, mixinURL)
+	if err != nil {
+		return nil, err
+	}
+	return generate(name, opts)
+}
+
+// newResult returns the paths of the files of the mixin vendored as name.
+func newResult(name string, opts Options) *Result {
+	dir := filepath.Join(opts.Directory, outputName(name))
+	return &Result{
+		MixinFile:           filepath.Join(opts.Directory, opts.JsonnetHome, name, "mixin.libsonnet"),
+		Directory:           dir,
+		AlertsFile:          filepath.Join(dir, opts.AlertsFilename),
+		RulesFile:           filepath.Join(dir, opts.RulesFilename),
+		DashboardsDirectory: filepath.Join(dir, opts.DashboardsDirectory),
+	}
+}
+
+// outputName returns the name of the subdirectory the files of the mixin
+// vendored as name are generated into, which is the last element of name.
+func outputName(name string) string {
+	return path.Base(filepath.ToSlash(name))
+}
+
+// checkOutputDirectory returns an error if another installed mixin
+// generates its files into the same subdirectory as the one at mixinURL.
+func checkOutputDirectory(mixinURL string, opts Options) error {
+	name, err := jsonnetbundler.DependencyName(opts.Directory, mixinURL)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(opts.Directory, jsonnetfile.File)); os.IsNotExist(err) {
+		return nil
+	}
+	installed, err := jsonnetbundler.Dependencies(opts.Directory)
+	if err != nil {
+		return err
+	}
+	for _, other := range installed {
+		if other != name && outputName(other) == outputName(name) {
+			return fmt.Errorf("cannot install %s next to %s, both generate their files into %s", name, other, outputName(name))
+		}
+	}
+	return nil
+}
+
+// generate writes the files of the mixin vendored as name, with opts
+// already completed.
+func generate(name string, opts Options) (*Result, error) {
+	result := newResult(name, opts)
+	if err := os.MkdirAll(result.Directory, 0755); err != nil {
+		return nil, err
+	}
+	generateOpts := mixer.GenerateOptions{
+		JPaths: []string{filepath.Join(opts.Directory, opts.JsonnetHome)},
+		YAML:   true,
+	}
+
+	alerts, err := mixer.GenerateAlerts(result.MixinFile, generateOpts)
+	if err != nil {
+		return nil, fmt.Errorf("generate alerts: %w", err)
+	}
+	if err := os.WriteFile(result.AlertsFile, alerts, 0644); err != nil {
+		return nil, err
+	}
+
+	rules, err := mixer.GenerateRules(result.MixinFile, generateOpts)
+	if err != nil {
+		return nil, fmt.Errorf("generate rules: %w", err)
+	}
+	if err := os.WriteFile(result.RulesFile, rules, 0644); err != nil {
+		return nil, err
+	}
+
+	dashboards, err := mixer.GenerateDashboards(result.MixinFile, generateOpts)
+	if err != nil {
+		return nil, fmt.Errorf("generate dashboards: %w", err)
+	}
+	if err := os.MkdirAll(result.DashboardsDirectory, 0755); err != nil {
+		return nil, err
+	}
+	for name, dashboard := range dashboards {
+		if err := os.WriteFile(filepath.Join(result.DashboardsDirectory, name), dashboard, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write dashboard: %w", err)
+		}
+	}
+	if err := removeStaleDashboards(result.DashboardsDirectory, dashboards); err != nil {
+		return nil, err
+	}
+
+	result.RulesAlerts, err = mixer.GenerateRulesAlerts(result.MixinFile, generateOpts)
+	if err != nil {
+		return nil, fmt.Errorf("generate rules and alerts: %w", err)
+	}
+	return result, nil
+}
+
+// removeStaleDashboards removes dashboards from directory the mixin no
+// longer generates, for example after an upgrade.
+func removeStaleDashboards(directory string, dashboards map[string]json.RawMessage) error {
+	files, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if _, ok := dashboards[f.Name()]; ok || f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(directory, f.Name())); err != nil {
+			return fmt.Errorf("failed to remove dashboard: %w", err)
+		}
+	}
+	return nil
+}
+
+// complete returns the options with defaults applied and Directory
+// made absolute.
+func (o Options) complete() (Options, error) {
+	if o.Directory == "" {
+		return o, fmt.Errorf("must specify a directory to install the mixin into")
+	}
+	dir, err := filepath.Abs(o.Directory)
+	if err != nil {
+		return o, err
+	}
+	o.Directory = dir
+
+	if o.JsonnetHome == "" {
+		o.JsonnetHome = "vendor"
+	}
+	if o.AlertsFilename == "" {
+		o.AlertsFilename = "alerts.yaml"
+	}
+	if o.RulesFilename == "" {
+		o.RulesFilename = "rules.yaml"
+	}
+	if o.DashboardsDirectory == "" {
+		o.DashboardsDirectory = "dashboards_out"
+	}
+	return o, nil
+}
+
+// IsLocal reports whether source refers to a local directory or tarball
+// instead of a git repository.
+func IsLocal(source string) bool {
+	_, err := os.Stat(source)
+	return err == nil
+}
+
+// resolveSource returns the jsonnet-bundler URI of source. Local
+// directories are made absolute, and tarballs are extracted into the
+// sources directory of the install directory first.
+func resolveSource(source string, opts Options) (string, error) {
+	if !IsLocal(source) {
+		return source, nil
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return filepath.Abs(source)
+	}
+	if !IsTarball(source) {
+		return "", fmt.Errorf("%s is neither a directory nor a tarball", source)
+	}
+	return extractTarball(source, filepath.Join(opts.Directory, "sources"))
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/monitoring-mixins/mixtool/pkg/jsonnetbundler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMixin = `
+local lib = import 'github.com/example/lib/lib.libsonnet';
+{
+  prometheusAlerts+:: {
+    groups+: [{ name: 'example', rules: [{ alert: 'ExampleDown', expr: lib.expr }] }],
+  },
+  prometheusRules+:: {
+    groups+: [{ name: 'example.rules', rules: [{ record: 'example:up', expr: lib.expr }] }],
+  },
+  grafanaDashboards+:: {
+    'example.json': { title: 'Example' },
+  },
+}
+`
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	mixinDir := filepath.Join(dir, "vendor", "github.com", "example", "repo", "example-mixin")
+	libDir := filepath.Join(dir, "vendor", "github.com", "example", "lib")
+	assert.NoError(t, os.MkdirAll(mixinDir, 0755))
+	assert.NoError(t, os.MkdirAll(libDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(mixinDir, "mixin.libsonnet"), []byte(testMixin), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(libDir, "lib.libsonnet"), []byte(`{ expr: 'up == 0' }`), 0644))
+
+	result, err := Generate("https://github.com/example/repo.git/example-mixin", Options{Directory: dir})
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(mixinDir, "mixin.libsonnet"), result.MixinFile)
+	assert.Equal(t, filepath.Join(dir, "example-mixin", "dashboards_out"), result.DashboardsDirectory)
+
+	alerts, err := os.ReadFile(filepath.Join(dir, "example-mixin", "alerts.yaml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(alerts), "ExampleDown")
+
+	rules, err := os.ReadFile(filepath.Join(dir, "example-mixin", "rules.yaml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(rules), "example:up")
+
+	_, err = os.Stat(filepath.Join(dir, "example-mixin", "dashboards_out", "example.json"))
+	assert.NoError(t, err)
+
+	assert.Contains(t, string(result.RulesAlerts), "ExampleDown")
+	assert.Contains(t, string(result.RulesAlerts), "example:up")
+}
+
+func TestOptionsComplete(t *testing.T) {
+	_, err := Options{}.complete()
+	assert.Error(t, err)
+
+	opts, err := Options{Directory: "relative"}.complete()
+	assert.NoError(t, err)
+	assert.True(t, filepath.IsAbs(opts.Directory))
+	assert.Equal(t, "vendor", opts.JsonnetHome)
+}
+
+const localMixin = `
+{
+  prometheusAlerts+:: {
+    groups+: [{ name: 'local', rules: [{ alert: 'LocalDown', expr: 'up == 0' }] }],
+  },
+}
+`
+
+func writeLocalMixin(t *testing.T, dir string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mixin.libsonnet"), []byte(localMixin), 0644))
+}
+
+func TestInstallLocalDirectory(t *testing.T) {
+	mixinDir := filepath.Join(t.TempDir(), "local-mixin")
+	writeLocalMixin(t, mixinDir)
+	dir := t.TempDir()
+
+	result, err := Install(mixinDir, Options{Directory: dir})
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(dir, "vendor", "local-mixin", "mixin.libsonnet"), result.MixinFile)
+	assert.Empty(t, result.Version)
+	assert.Contains(t, string(result.RulesAlerts), "LocalDown")
+
+	// The dependency is recorded relative to the install directory.
+	jsonnetfile, err := os.ReadFile(filepath.Join(dir, "jsonnetfile.json"))
+	require.NoError(t, err)
+	rel, err := filepath.Rel(dir, mixinDir)
+	require.NoError(t, err)
+	assert.Contains(t, string(jsonnetfile), filepath.ToSlash(rel))
+
+	_, err = Install(mixinDir, Options{Directory: dir, Version: "v1.0.0"})
+	assert.Error(t, err)
+}
+
+func TestInstallMultiple(t *testing.T) {
+	sources := t.TempDir()
+	first := filepath.Join(sources, "first-mixin")
+	second := filepath.Join(sources, "second-mixin")
+	writeLocalMixin(t, first)
+	writeLocalMixin(t, second)
+	dir := t.TempDir()
+
+	// Installing is idempotent and additive.
+	for _, mixin := range []string{first, first, second} {
+		_, err := Install(mixin, Options{Directory: dir})
+		require.NoError(t, err, mixin)
+	}
+
+	installed, err := Installed(Options{Directory: dir})
+	require.NoError(t, err)
+	assert.Equal(t, []Mixin{{Name: "first-mixin"}, {Name: "second-mixin"}}, installed)
+
+	for _, name := range []string{"first-mixin", "second-mixin"} {
+		_, err := os.Stat(filepath.Join(dir, name, "alerts.yaml"))
+		assert.NoError(t, err, name)
+	}
+
+	// A mixin generating its files into the same subdirectory is rejected
+	// before it is downloaded.
+	_, err = Install("https://github.com/example/repo/first-mixin", Options{Directory: dir})
+	assert.ErrorContains(t, err, "both generate their files into first-mixin")
+}
+
+func TestInstallTarball(t *testing.T) {
+	tmp := t.TempDir()
+	tarball := filepath.Join(tmp, "local-mixin-1.0.tar.gz")
+
+	f, err := os.Create(tarball)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "local-mixin/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "local-mixin/mixin.libsonnet", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(localMixin))}))
+	_, err = tw.Write([]byte(localMixin))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+
+	dir := filepath.Join(tmp, "install")
+	result, err := Install(tarball, Options{Directory: dir})
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(dir, "vendor", "local-mixin", "mixin.libsonnet"), result.MixinFile)
+	assert.Contains(t, string(result.RulesAlerts), "LocalDown")
+	_, err = os.Stat(filepath.Join(dir, "sources", "local-mixin-1.0", "local-mixin", "mixin.libsonnet"))
+	assert.NoError(t, err)
+
+	// Uninstalling removes the extracted copy as well.
+	_, err = Uninstall("local-mixin", Options{Directory: dir})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "sources", "local-mixin-1.0"))
+	assert.True(t, os.IsNotExist(err), "extracted tarball must be removed")
+	_, err = os.Stat(tarball)
+	assert.NoError(t, err)
+}
+
+func TestExtractTarballPathTraversal(t *testing.T) {
+	tmp := t.TempDir()
+	tarball := filepath.Join(tmp, "evil.tar")
+
+	f, err := os.Create(tarball)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}))
+	_, err = tw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	_, err = extractTarball(tarball, filepath.Join(tmp, "sources"))
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(tmp, "evil"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDependencyName(t *testing.T) {
+	for url, expected := range map[string]string{
+		"https://github.com/example/repo/example-mixin":     "github.com/example/repo/example-mixin",
+		"https://github.com/example/repo.git":               "github.com/example/repo",
+		"github.com/example/repo/example-mixin":             "github.com/example/repo/example-mixin",
+		"https://github.com/example/repo.git/example-mixin": "github.com/example/repo/example-mixin",
+		"git@git.example.com:example/repo.git/mixin":        "git.example.com/example/repo/mixin",
+		"ssh://git@git.example.com/example/repo.git/mixin":  "git.example.com/example/repo/mixin",
+	} {
+		name, err := jsonnetbundler.DependencyName(".", url)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, name, url)
+	}
+}
+
+func TestSplitVersion(t *testing.T) {
+	for _, tc := range []struct {
+		mixin, name, version string
+	}{
+		{"kubernetes", "kubernetes", ""},
+		{"kubernetes@v1.2.3", "kubernetes", "v1.2.3"},
+		{"https://github.com/example/repo/example-mixin", "https://github.com/example/repo/example-mixin", ""},
+		{"https://github.com/example/repo/example-mixin@release/1.0", "https://github.com/example/repo/example-mixin", "release/1.0"},
+		{"git@github.com:example/repo.git", "git@github.com:example/repo.git", ""},
+		{"git@github.com:example/repo.git/example-mixin@abc123", "git@github.com:example/repo.git/example-mixin", "abc123"},
+		{"ssh://git@github.com/example/repo.git", "ssh://git@github.com/example/repo.git", ""},
+	} {
+		name, version := SplitVersion(tc.mixin)
+		assert.Equal(t, tc.name, name, tc.mixin)
+		assert.Equal(t, tc.version, version, tc.mixin)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var tarballExtensions = []string{".tar.gz", ".tgz", ".tar"}
+
+// IsTarball reports whether filename has the extension of a tarball mixtool
+// installs mixins from.
+func IsTarball(filename string) bool {
+	return tarballName(filename) != ""
+}
+
+// tarballName returns the name of the tarball without its extension,
+// or an empty string if filename is not a tarball.
+func tarballName(filename string) string {
+	base := filepath.Base(filename)
+	for _, ext := range tarballExtensions {
+		if name, ok := strings.CutSuffix(base, ext); ok && name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// extractTarball extracts filename into a directory named after it inside
+// dir, replacing earlier extractions. It returns the absolute path of the
+// extracted mixin, which is the single top-level directory of the tarball
+// if it has one.
+func extractTarball(filename, dir string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	if !strings.HasSuffix(filename, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+
+	target, err := filepath.Abs(filepath.Join(dir, tarballName(filename)))
+	if err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return "", err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+
+		name := filepath.Join(target, filepath.FromSlash(hdr.Name))
+		if name == target {
+			continue
+		}
+		if !strings.HasPrefix(name, target+string(filepath.Separator)) {
+			return "", fmt.Errorf("invalid path %s in %s", hdr.Name, filename)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return "", err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return "", err
+			}
+			if err := writeTarFile(name, tr); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(target, entries[0].Name()), nil
+	}
+	return target, nil
+}
+
+func writeTarFile(name string, r io.Reader) (retErr error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && retErr == nil {
+			retErr = cerr
+		}
+	}()
+
+	_, err = io.Copy(f, r)
+	return err
+}
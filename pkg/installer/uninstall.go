@@ -0,0 +1,83 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/monitoring-mixins/mixtool/pkg/jsonnetbundler"
+)
+
+// Uninstall removes the installed mixin with the given name, its vendored
+// files, the files generated from it and the copy of a tarball it was
+// extracted from. The name is either the full name
+// of its jsonnet-bundler dependency or the last element of it, like
+// node-mixin for github.com/prometheus/node_exporter/docs/node-mixin.
+func Uninstall(name string, opts Options) (Mixin, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return Mixin{}, err
+	}
+
+	installed, err := Installed(opts)
+	if err != nil {
+		return Mixin{}, err
+	}
+	m, err := lookup(name, installed)
+	if err != nil {
+		return Mixin{}, err
+	}
+
+	source, err := jsonnetbundler.LocalDirectory(opts.Directory, m.Name)
+	if err != nil {
+		return m, err
+	}
+	if err := jsonnetbundler.UninstallCommand(opts.Directory, opts.JsonnetHome, m.Name); err != nil {
+		return m, fmt.Errorf("jsonnet bundler uninstall failed %v", err)
+	}
+	// Only the sources extracted from tarballs belong to the install
+	// directory, other local mixins are left untouched.
+	sources, err := filepath.Abs(filepath.Join(opts.Directory, "sources"))
+	if err != nil {
+		return m, err
+	}
+	if rel, err := filepath.Rel(sources, source); source != "" && err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		// The tarball is extracted into a directory named after it.
+		extracted := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+		if err := os.RemoveAll(filepath.Join(sources, extracted)); err != nil {
+			return m, err
+		}
+	}
+
+	result := newResult(m.Name, opts)
+	for _, f := range []string{result.AlertsFile, result.RulesFile} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return m, err
+		}
+	}
+	if err := os.RemoveAll(result.DashboardsDirectory); err != nil {
+		return m, err
+	}
+	// The subdirectory of the mixin is kept if it contains other files.
+	if err := os.Remove(result.Directory); err != nil && !os.IsNotExist(err) {
+		if entries, rerr := os.ReadDir(result.Directory); rerr != nil || len(entries) == 0 {
+			return m, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,265 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/monitoring-mixins/mixtool/pkg/jsonnetbundler"
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/prometheus/prometheus/model/rulefmt"
+)
+
+// Mixin is a mixin installed into a directory.
+type Mixin struct {
+	// Name is the name of the jsonnet-bundler dependency, which is the
+	// directory the mixin is vendored into.
+	Name string
+	// Version is the commit the mixin is locked to. It is empty for local
+	// mixins.
+	Version string
+}
+
+// UpgradeResult describes the changes upgrading a mixin made to its files.
+type UpgradeResult struct {
+	Mixin       string
+	FromVersion string
+	ToVersion   string
+	Alerts      mixer.RulesDiff
+	Rules       mixer.RulesDiff
+	Dashboards  mixer.DashboardsDiff
+	Result      *Result
+}
+
+// Installed returns the mixins installed into opts.Directory, which are the
+// direct dependencies of its jsonnetfile.
+func Installed(opts Options) ([]Mixin, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := jsonnetbundler.Dependencies(opts.Directory)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := jsonnetbundler.LockedVersions(opts.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	mixins := make([]Mixin, 0, len(names))
+	for _, name := range names {
+		mixins = append(mixins, Mixin{Name: name, Version: versions[name]})
+	}
+	return mixins, nil
+}
+
+// Upgrade installs the latest versions of the named mixins and regenerates
+// their files. Mixins are named like in Uninstall. The versions are the latest
+// allowed by the jsonnetfile, so mixins pinned to a tag or commit stay at
+// it. Without names, all mixins and their dependencies are upgraded.
+func Upgrade(names []string, opts Options) ([]UpgradeResult, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	installed, err := Installed(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	mixins := installed
+	if len(names) > 0 {
+		mixins = make([]Mixin, 0, len(names))
+		for _, name := range names {
+			m, err := lookup(name, installed)
+			if err != nil {
+				return nil, err
+			}
+			mixins = append(mixins, m)
+		}
+	}
+	if len(mixins) == 0 {
+		return nil, fmt.Errorf("no mixins installed in %s", opts.Directory)
+	}
+
+	// The files are read before upgrading to diff them afterwards.
+	before := make([]outputs, len(mixins))
+	for i, m := range mixins {
+		before[i], err = readOutputs(newResult(m.Name, opts))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var update []string
+	if len(names) > 0 {
+		for _, m := range mixins {
+			update = append(update, m.Name)
+		}
+	}
+	if err := jsonnetbundler.UpdateCommand(opts.Directory, opts.JsonnetHome, update...); err != nil {
+		return nil, fmt.Errorf("jsonnet bundler update failed %v", err)
+	}
+
+	versions, err := jsonnetbundler.LockedVersions(opts.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]UpgradeResult, 0, len(mixins))
+	for i, m := range mixins {
+		result, err := generate(m.Name, opts)
+		if err != nil {
+			return nil, fmt.Errorf("upgrade %s: %w", m.Name, err)
+		}
+		result.Version = versions[m.Name]
+
+		after, err := readOutputs(result)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, UpgradeResult{
+			Mixin:       m.Name,
+			FromVersion: m.Version,
+			ToVersion:   result.Version,
+			Alerts:      mixer.DiffRules(before[i].alerts, after.alerts),
+			Rules:       mixer.DiffRules(before[i].rules, after.rules),
+			Dashboards:  mixer.DiffDashboards(before[i].dashboards, after.dashboards),
+			Result:      result,
+		})
+	}
+	return results, nil
+}
+
+// Lookup returns the files of the installed mixin with the given name,
+// named like in Uninstall.
+func Lookup(name string, opts Options) (*Result, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	installed, err := Installed(opts)
+	if err != nil {
+		return nil, err
+	}
+	m, err := lookup(name, installed)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newResult(m.Name, opts)
+	result.Version = m.Version
+	return result, nil
+}
+
+// lookup returns the installed mixin with the given name, either the full
+// name of its dependency or the last element of it, like node-mixin for
+// github.com/prometheus/node_exporter/docs/node-mixin.
+func lookup(name string, installed []Mixin) (Mixin, error) {
+	var found []Mixin
+	for _, m := range installed {
+		if m.Name == name {
+			return m, nil
+		}
+		if outputName(m.Name) == name {
+			found = append(found, m)
+		}
+	}
+
+	switch len(found) {
+	case 1:
+		return found[0], nil
+	case 0:
+		return Mixin{}, fmt.Errorf("mixin %s is not installed", name)
+	}
+	ambiguous := make([]string, 0, len(found))
+	for _, m := range found {
+		ambiguous = append(ambiguous, m.Name)
+	}
+	return Mixin{}, fmt.Errorf("mixin name %s is ambiguous, use one of %s", name, strings.Join(ambiguous, ", "))
+}
+
+// outputs are the generated files of a mixin.
+type outputs struct {
+	alerts     []rulefmt.RuleGroup
+	rules      []rulefmt.RuleGroup
+	dashboards map[string][]byte
+}
+
+func readOutputs(r *Result) (outputs, error) {
+	var o outputs
+	var err error
+
+	if o.alerts, err = readRuleGroups(r.AlertsFile); err != nil {
+		return o, err
+	}
+	if o.rules, err = readRuleGroups(r.RulesFile); err != nil {
+		return o, err
+	}
+	if o.dashboards, err = readDashboards(r.DashboardsDirectory); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// readRuleGroups returns the rule groups in filename, or none if it does
+// not exist.
+func readRuleGroups(filename string) ([]rulefmt.RuleGroup, error) {
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groups, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid rules in %s: %w", filename, errs[0])
+	}
+	return groups.Groups, nil
+}
+
+// readDashboards returns the dashboards in directory by their filename.
+func readDashboards(directory string) (map[string][]byte, error) {
+	dashboards := map[string][]byte{}
+
+	files, err := os.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return dashboards, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(directory, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		dashboards[f.Name()] = content
+	}
+	return dashboards, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/monitoring-mixins/mixtool/pkg/mixer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const upgradedMixin = `
+{
+  prometheusAlerts+:: {
+    groups+: [{ name: 'local', rules: [{ alert: 'LocalDown', expr: 'up == 0', 'for': '5m' }] }],
+  },
+  grafanaDashboards+:: {
+    'local.json': { title: 'Local' },
+  },
+}
+`
+
+func TestUpgrade(t *testing.T) {
+	mixinDir := filepath.Join(t.TempDir(), "local-mixin")
+	writeLocalMixin(t, mixinDir)
+	dir := t.TempDir()
+
+	_, err := Install(mixinDir, Options{Directory: dir})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(mixinDir, "mixin.libsonnet"), []byte(upgradedMixin), 0644))
+
+	results, err := Upgrade([]string{"local-mixin"}, Options{Directory: dir})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	assert.Equal(t, "local-mixin", results[0].Mixin)
+	assert.Equal(t, []mixer.GroupDiff{{Name: "local", ChangedRules: []string{"alert LocalDown"}}}, results[0].Alerts.ChangedGroups)
+	assert.True(t, results[0].Rules.Empty())
+	assert.Equal(t, []string{"local.json"}, results[0].Dashboards.Added)
+
+	// Upgrading again changes nothing.
+	results, err = Upgrade(nil, Options{Directory: dir})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Alerts.Empty())
+	assert.True(t, results[0].Dashboards.Empty())
+
+	_, err = Upgrade([]string{"other-mixin"}, Options{Directory: dir})
+	assert.Error(t, err)
+}
+
+func TestUninstall(t *testing.T) {
+	mixinDir := filepath.Join(t.TempDir(), "local-mixin")
+	writeLocalMixin(t, mixinDir)
+	dir := t.TempDir()
+
+	result, err := Install(mixinDir, Options{Directory: dir})
+	require.NoError(t, err)
+
+	m, err := Uninstall("local-mixin", Options{Directory: dir})
+	require.NoError(t, err)
+	assert.Equal(t, "local-mixin", m.Name)
+
+	for _, f := range []string{filepath.Join(dir, "vendor", "local-mixin"), result.AlertsFile, result.RulesFile, result.DashboardsDirectory, result.Directory} {
+		_, err := os.Lstat(f)
+		assert.True(t, os.IsNotExist(err), f)
+	}
+
+	installed, err := Installed(Options{Directory: dir})
+	require.NoError(t, err)
+	assert.Empty(t, installed)
+
+	// The local mixin itself is left untouched.
+	_, err = os.Stat(filepath.Join(mixinDir, "mixin.libsonnet"))
+	assert.NoError(t, err)
+
+	_, err = Uninstall("local-mixin", Options{Directory: dir})
+	assert.Error(t, err)
+}
+
+func TestLookup(t *testing.T) {
+	installed := []Mixin{
+		{Name: "github.com/example/repo/node-mixin"},
+		{Name: "github.com/example/repo/example-mixin"},
+		{Name: "github.com/other/repo/example-mixin"},
+	}
+
+	m, err := lookup("node-mixin", installed)
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com/example/repo/node-mixin", m.Name)
+
+	m, err = lookup("github.com/other/repo/example-mixin", installed)
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com/other/repo/example-mixin", m.Name)
+
+	_, err = lookup("example-mixin", installed)
+	assert.ErrorContains(t, err, "ambiguous")
+
+	_, err = lookup("missing", installed)
+	assert.Error(t, err)
+}
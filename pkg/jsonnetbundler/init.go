@@ -26,7 +26,9 @@ import (
 
 // InitCommand is basically the same as jb init
 func InitCommand(dir string) error {
-	exists, err := jsonnetfile.Exists(jsonnetfile.File)
+	filename := filepath.Join(dir, jsonnetfile.File)
+
+	exists, err := jsonnetfile.Exists(filename)
 	if err != nil {
 		return err
 	}
@@ -45,8 +47,6 @@ func InitCommand(dir string) error {
 	}
 	contents = append(contents, []byte("\n")...)
 
-	filename := filepath.Join(dir, jsonnetfile.File)
-
 	err = os.WriteFile(filename, contents, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write new jsonnetfile.json: %s", err.Error())
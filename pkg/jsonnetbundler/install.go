@@ -62,7 +62,7 @@ func InstallCommand(dir, jsonnetHome string, uris []string, single bool) error {
 	}
 
 	for _, u := range uris {
-		d := deps.Parse(dir, u)
+		d := parseDependency(dir, u)
 		if d == nil {
 			return fmt.Errorf("unable to parse package URI %s", u)
 		}
@@ -72,11 +72,8 @@ func InstallCommand(dir, jsonnetHome string, uris []string, single bool) error {
 		}
 
 		value, ok := jsonnetFile.Dependencies.Get(d.Name())
-		if !ok {
-			return fmt.Errorf("failed to find package %s", d.Name())
-		}
-		if !depEqual(value, *d) {
-			// the dep passed on the cli is different from the jsonnetFile
+		if !ok || !depEqual(value, *d) {
+			// the dep passed on the cli is new or different from the jsonnetFile
 			jsonnetFile.Dependencies.Set(d.Name(), *d)
 
 			// we want to install the passed version (ignore the lock)
@@ -85,7 +82,7 @@ func InstallCommand(dir, jsonnetHome string, uris []string, single bool) error {
 	}
 
 	jsonnetPkgHomeDir := filepath.Join(dir, jsonnetHome)
-	locked, err := pkg.Ensure(jsonnetFile, jsonnetPkgHomeDir, lockFile.Dependencies)
+	locked, err := ensure(dir, jsonnetFile, jsonnetPkgHomeDir, lockFile.Dependencies)
 	if err != nil {
 		return fmt.Errorf("failed to install packages %s", err)
 	}
@@ -135,3 +132,122 @@ func writeChangedJsonnetFile(originalBytes []byte, modified *v1.JsonnetFile, pat
 
 	return writeJSONFile(path, *modified)
 }
+
+// LockedVersion returns the version the dependency at uri is locked to in
+// the lock file of dir, which is the commit it has been resolved to.
+func LockedVersion(dir, uri string) (string, error) {
+	d := parseDependency(dir, uri)
+	if d == nil {
+		return "", fmt.Errorf("unable to parse package URI %s", uri)
+	}
+
+	versions, err := LockedVersions(dir)
+	if err != nil {
+		return "", err
+	}
+	version, ok := versions[d.Name()]
+	if !ok {
+		return "", fmt.Errorf("package %s is not locked", d.Name())
+	}
+	return version, nil
+}
+
+// LockedVersions returns the versions of all dependencies in the lock
+// file of dir by their name.
+func LockedVersions(dir string) (map[string]string, error) {
+	jblockfilebytes, err := os.ReadFile(filepath.Join(dir, jsonnetfile.LockFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lockfile %s", err.Error())
+	}
+
+	lockFile, err := jsonnetfile.Unmarshal(jblockfilebytes)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := map[string]string{}
+	for el := lockFile.Dependencies.Front(); el != nil; el = el.Next() {
+		versions[el.Key] = el.Value.Version
+	}
+	return versions, nil
+}
+
+// Dependencies returns the names of the direct dependencies of dir, in the
+// order of its jsonnetfile.
+func Dependencies(dir string) ([]string, error) {
+	jbfilebytes, err := os.ReadFile(filepath.Join(dir, jsonnetfile.File))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jsonnetfile %s", err.Error())
+	}
+
+	jsonnetFile, err := jsonnetfile.Unmarshal(jbfilebytes)
+	if err != nil {
+		return nil, err
+	}
+	return jsonnetFile.Dependencies.Keys(), nil
+}
+
+// LocalDirectory returns the absolute directory of the local dependency
+// name of dir, or an empty string if it is not a local dependency.
+func LocalDirectory(dir, name string) (string, error) {
+	jbfilebytes, err := os.ReadFile(filepath.Join(dir, jsonnetfile.File))
+	if err != nil {
+		return "", fmt.Errorf("failed to load jsonnetfile %s", err.Error())
+	}
+
+	jsonnetFile, err := jsonnetfile.Unmarshal(jbfilebytes)
+	if err != nil {
+		return "", err
+	}
+	d, ok := jsonnetFile.Dependencies.Get(name)
+	if !ok || d.Source.LocalSource == nil {
+		return "", nil
+	}
+	return filepath.Abs(filepath.Join(dir, d.Source.LocalSource.Directory))
+}
+
+// DependencyName returns the name of the dependency at uri, which is the
+// directory it is vendored into.
+func DependencyName(dir, uri string) (string, error) {
+	d := parseDependency(dir, uri)
+	if d == nil {
+		return "", fmt.Errorf("unable to parse package URI %s", uri)
+	}
+	if d.Source.LocalSource != nil {
+		// Local dependencies are vendored by the base name of their
+		// directory, which is relative to dir.
+		abs, err := filepath.Abs(filepath.Join(dir, d.Source.LocalSource.Directory))
+		if err != nil {
+			return "", err
+		}
+		return filepath.Base(abs), nil
+	}
+	return d.Name(), nil
+}
+
+// parseDependency is deps.Parse, additionally accepting local dependencies
+// given by an absolute path. They are recorded relative to dir, like the
+// relative local dependencies deps.Parse accepts.
+func parseDependency(dir, uri string) *deps.Dependency {
+	if !filepath.IsAbs(uri) {
+		return deps.Parse(dir, uri)
+	}
+
+	info, err := os.Stat(uri)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	directory, err := filepath.Rel(abs, uri)
+	if err != nil {
+		return nil
+	}
+	return &deps.Dependency{
+		Source: deps.Source{
+			LocalSource: &deps.Local{Directory: directory},
+		},
+	}
+}
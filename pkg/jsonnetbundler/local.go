@@ -0,0 +1,77 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnetbundler
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// ensure is pkg.Ensure for the project in dir. Local dependencies are
+// relative to dir in the jsonnetfile and lock file, but jsonnet-bundler
+// resolves them against the working directory, so they are relocated
+// for the duration of the call.
+func ensure(dir string, jsonnetFile v1.JsonnetFile, vendorDir string, locks *deps.Ordered) (*deps.Ordered, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	direct, err := relocateLocal(jsonnetFile.Dependencies, dir, wd)
+	if err != nil {
+		return nil, err
+	}
+	locks, err = relocateLocal(locks, dir, wd)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := pkg.Ensure(v1.JsonnetFile{Dependencies: direct, LegacyImports: jsonnetFile.LegacyImports}, vendorDir, locks)
+	if err != nil {
+		return nil, err
+	}
+	return relocateLocal(locked, wd, dir)
+}
+
+// relocateLocal returns a copy of dependencies with the directories of
+// local dependencies, relative to from, made relative to to.
+func relocateLocal(dependencies *deps.Ordered, from, to string) (*deps.Ordered, error) {
+	from, err := filepath.Abs(from)
+	if err != nil {
+		return nil, err
+	}
+	to, err = filepath.Abs(to)
+	if err != nil {
+		return nil, err
+	}
+
+	relocated := deps.NewOrdered()
+	for el := dependencies.Front(); el != nil; el = el.Next() {
+		d := el.Value
+		if d.Source.LocalSource != nil {
+			directory, err := filepath.Rel(to, filepath.Join(from, d.Source.LocalSource.Directory))
+			if err != nil {
+				return nil, err
+			}
+			d.Source.LocalSource = &deps.Local{Directory: directory}
+		}
+		relocated.Set(el.Key, d)
+	}
+	return relocated, nil
+}
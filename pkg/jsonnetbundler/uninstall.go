@@ -0,0 +1,86 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnetbundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+)
+
+// UninstallCommand is basically the same as jb uninstall, it removes the
+// named dependencies from the jsonnetfile and lock file, and their files
+// and the ones of dependencies no longer needed from the vendor directory.
+func UninstallCommand(dir, jsonnetHome string, names ...string) error {
+	if dir == "" {
+		dir = "."
+	}
+
+	jbfilebytes, err := os.ReadFile(filepath.Join(dir, jsonnetfile.File))
+	if err != nil {
+		return fmt.Errorf("failed to load jsonnetfile %s", err.Error())
+	}
+
+	jsonnetFile, err := jsonnetfile.Unmarshal(jbfilebytes)
+	if err != nil {
+		return err
+	}
+
+	jblockfilebytes, err := os.ReadFile(filepath.Join(dir, jsonnetfile.LockFile))
+	if !os.IsNotExist(err) {
+		if err != nil {
+			return fmt.Errorf("failed to load lockfile %s", err.Error())
+		}
+	}
+
+	lockFile, err := jsonnetfile.Unmarshal(jblockfilebytes)
+	if err != nil {
+		return err
+	}
+
+	jsonnetPkgHomeDir := filepath.Join(dir, jsonnetHome)
+	for _, name := range names {
+		if !jsonnetFile.Dependencies.Delete(name) {
+			return fmt.Errorf("package %s is not a dependency", name)
+		}
+		lockFile.Dependencies.Delete(name)
+
+		// Local dependencies are symlinks, which are not cleaned up by
+		// jsonnet-bundler.
+		if err := os.RemoveAll(filepath.Join(jsonnetPkgHomeDir, name)); err != nil {
+			return fmt.Errorf("failed to remove package %s", err)
+		}
+	}
+
+	locked, err := ensure(dir, jsonnetFile, jsonnetPkgHomeDir, lockFile.Dependencies)
+	if err != nil {
+		return fmt.Errorf("failed to uninstall packages %s", err)
+	}
+
+	err = writeChangedJsonnetFile(jbfilebytes, &jsonnetFile, filepath.Join(dir, jsonnetfile.File))
+	if err != nil {
+		return fmt.Errorf("updating jsonnetfile.json %s", err)
+	}
+
+	err = writeChangedJsonnetFile(jblockfilebytes, &v1.JsonnetFile{Dependencies: locked}, filepath.Join(dir, jsonnetfile.LockFile))
+	if err != nil {
+		return fmt.Errorf("updating jsonnetfile.lock.json %s", err)
+	}
+
+	return nil
+}
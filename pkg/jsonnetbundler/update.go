@@ -0,0 +1,84 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnetbundler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// UpdateCommand is basically the same as jb update, it installs the latest
+// versions of the named dependencies, or of all if none are named, ignoring
+// the lock file, and updates it.
+func UpdateCommand(dir, jsonnetHome string, names ...string) error {
+	if dir == "" {
+		dir = "."
+	}
+
+	jbfilebytes, err := os.ReadFile(filepath.Join(dir, jsonnetfile.File))
+	if err != nil {
+		return fmt.Errorf("failed to load jsonnetfile %s", err.Error())
+	}
+
+	jsonnetFile, err := jsonnetfile.Unmarshal(jbfilebytes)
+	if err != nil {
+		return err
+	}
+
+	jblockfilebytes, err := os.ReadFile(filepath.Join(dir, jsonnetfile.LockFile))
+	if !os.IsNotExist(err) {
+		if err != nil {
+			return fmt.Errorf("failed to load lockfile %s", err.Error())
+		}
+	}
+
+	locks := deps.NewOrdered()
+	if len(names) > 0 {
+		lockFile, err := jsonnetfile.Unmarshal(jblockfilebytes)
+		if err != nil {
+			return err
+		}
+		locks = lockFile.Dependencies
+		for _, name := range names {
+			if _, ok := jsonnetFile.Dependencies.Get(name); !ok {
+				return fmt.Errorf("package %s is not a dependency", name)
+			}
+			locks.Delete(name)
+		}
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, jsonnetHome, ".tmp"), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("creating vendor folder %s", err.Error())
+	}
+
+	jsonnetPkgHomeDir := filepath.Join(dir, jsonnetHome)
+	locked, err := ensure(dir, jsonnetFile, jsonnetPkgHomeDir, locks)
+	if err != nil {
+		return fmt.Errorf("failed to update packages %s", err)
+	}
+
+	err = writeChangedJsonnetFile(jblockfilebytes, &v1.JsonnetFile{Dependencies: locked}, filepath.Join(dir, jsonnetfile.LockFile))
+	if err != nil {
+		return fmt.Errorf("updating jsonnetfile.lock.json %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"gopkg.in/yaml.v3"
+)
+
+type canonicalRuleGroups struct {
+	Groups []canonicalRuleGroup `yaml:"groups"`
+}
+
+type canonicalRuleGroup struct {
+	Name        string          `yaml:"name"`
+	Interval    model.Duration  `yaml:"interval,omitempty"`
+	QueryOffset *model.Duration `yaml:"query_offset,omitempty"`
+	Limit       int             `yaml:"limit,omitempty"`
+	Rules       []rulefmt.Rule  `yaml:"rules"`
+}
+
+// CanonicalRules validates the rule groups in content and formats them in
+// a canonical form, so that rules which only differ in their formatting
+// are formatted identically.
+func CanonicalRules(content []byte) ([]byte, error) {
+	groups, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	canonical := canonicalRuleGroups{Groups: []canonicalRuleGroup{}}
+	for _, g := range groups.Groups {
+		c := canonicalRuleGroup{
+			Name:        g.Name,
+			Interval:    g.Interval,
+			QueryOffset: g.QueryOffset,
+			Limit:       g.Limit,
+			Rules:       make([]rulefmt.Rule, 0, len(g.Rules)),
+		}
+		for _, r := range g.Rules {
+			c.Rules = append(c.Rules, ruleFromNode(r))
+		}
+		canonical.Groups = append(canonical.Groups, c)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(canonical); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ruleFromNode returns the values of a rule, leaving out the formatting
+// of the YAML it has been parsed from.
+func ruleFromNode(n rulefmt.RuleNode) rulefmt.Rule {
+	r := rulefmt.Rule{
+		Record: n.Record.Value,
+		Alert:  n.Alert.Value,
+		// Surrounding whitespace, like the trailing newline of a
+		// block scalar, does not change the expression.
+		Expr:          strings.TrimSpace(n.Expr.Value),
+		For:           n.For,
+		KeepFiringFor: n.KeepFiringFor,
+		Labels:        n.Labels,
+		Annotations:   n.Annotations,
+	}
+	if len(r.Labels) == 0 {
+		r.Labels = nil
+	}
+	if len(r.Annotations) == 0 {
+		r.Annotations = nil
+	}
+	return r
+}
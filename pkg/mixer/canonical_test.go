@@ -0,0 +1,58 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalRules(t *testing.T) {
+	a, err := CanonicalRules([]byte(`
+groups:
+- name: g
+  interval: 1m
+  rules:
+  - alert: Down
+    expr: |
+      up == 0
+    for: 5m
+    labels:
+      severity: warning
+      team: a
+    annotations: {}
+`))
+	assert.NoError(t, err)
+
+	b, err := CanonicalRules([]byte(`{"groups": [{"rules": [{"labels": {"team": "a", "severity": "warning"}, "for": "300s", "expr": "up == 0", "alert": "Down"}], "name": "g", "interval": "60s"}]}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, `groups:
+  - name: g
+    interval: 1m
+    rules:
+      - alert: Down
+        expr: up == 0
+        for: 5m
+        labels:
+          severity: warning
+          team: a
+`, string(a))
+	assert.Equal(t, string(a), string(b))
+
+	_, err = CanonicalRules([]byte("groups:\n- name: g\n  rules:\n  - alert: Down\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+local g = import 'github.com/grafana/grafonnet/gen/grafonnet-latest/main.libsonnet';
+
+local dashboard = g.dashboard;
+local variable = dashboard.variable;
+local row = g.panel.row;
+local stat = g.panel.stat;
+local timeSeries = g.panel.timeSeries;
+local prometheus = g.query.prometheus;
+
+local datasource =
+  variable.datasource.new('datasource', 'prometheus')
+  + variable.datasource.generalOptions.withLabel('Data source');
+
+local labelVariable(name, label, metric) =
+  variable.query.new(name)
+  + variable.query.generalOptions.withLabel(label)
+  + variable.query.withDatasourceFromVariable(datasource)
+  + variable.query.queryTypes.withLabelValues(name, metric)
+  + variable.query.selectionOptions.withMulti()
+  + variable.query.selectionOptions.withIncludeAll(customAllValue='.+')
+  + variable.query.refresh.onTime();
+
+local query(expr, legendFormat) =
+  prometheus.new('${datasource}', expr)
+  + prometheus.withLegendFormat(legendFormat);
+
+local statPanel(title, description, unit, expr) =
+  stat.new(title)
+  + stat.panelOptions.withDescription(description)
+  + stat.queryOptions.withDatasource('prometheus', '${datasource}')
+  + stat.queryOptions.withTargets([query(expr, '')])
+  + stat.standardOptions.withUnit(unit);
+
+local timeSeriesPanel(title, description, unit, expr, legendFormat) =
+  timeSeries.new(title)
+  + timeSeries.panelOptions.withDescription(description)
+  + timeSeries.queryOptions.withDatasource('prometheus', '${datasource}')
+  + timeSeries.queryOptions.withTargets([query(expr, legendFormat)])
+  + timeSeries.standardOptions.withUnit(unit);
+
+{
+  grafanaDashboards+:: {
+    [[ quote (printf "%s.json" .Name) ]]:
+      dashboard.new([[ quote .Title ]])
+      + dashboard.withUid([[ quote .UID ]])
+      + dashboard.withDescription('Dashboard created with mixtool.')
+      + dashboard.withEditable(false)
+      + dashboard.time.withFrom('now-1h')
+      + dashboard.withVariables([
+        datasource,
+        labelVariable('job', 'Job', 'up'),
+        labelVariable('instance', 'Instance', 'up{job=~"$job"}'),
+      ])
+      + dashboard.withPanels([
+        row.new('Overview')
+        + row.withGridPos(0),
+        statPanel(
+          'Targets up',
+          'Number of targets that are up.',
+          'short',
+          'sum(up{job=~"$job", instance=~"$instance"})',
+        )
+        + stat.panelOptions.withGridPos(h=4, w=12, x=0, y=1),
+        statPanel(
+          'Targets down',
+          'Number of targets that are down.',
+          'short',
+          'count(up{job=~"$job", instance=~"$instance"} == 0) or vector(0)',
+        )
+        + stat.panelOptions.withGridPos(h=4, w=12, x=12, y=1),
+        row.new('Resources')
+        + row.withGridPos(5),
+        timeSeriesPanel(
+          'CPU usage',
+          'CPU cores used by each instance.',
+          'short',
+          'sum by (instance) (rate(process_cpu_seconds_total{job=~"$job", instance=~"$instance"}[$__rate_interval]))',
+          '{{instance}}',
+        )
+        + timeSeries.panelOptions.withGridPos(h=8, w=12, x=0, y=6),
+        timeSeriesPanel(
+          'Memory usage',
+          'Resident memory used by each instance.',
+          'bytes',
+          'sum by (instance) (process_resident_memory_bytes{job=~"$job", instance=~"$instance"})',
+          '{{instance}}',
+        )
+        + timeSeries.panelOptions.withGridPos(h=8, w=12, x=12, y=6),
+      ]),
+  },
+}
@@ -0,0 +1,49 @@
+local g = import 'github.com/grafana/grafonnet/gen/grafonnet-latest/main.libsonnet';
+
+local dashboard = g.dashboard;
+local variable = dashboard.variable;
+local timeSeries = g.panel.timeSeries;
+local prometheus = g.query.prometheus;
+
+local datasource =
+  variable.datasource.new('datasource', 'prometheus')
+  + variable.datasource.generalOptions.withLabel('Data source');
+
+local labelVariable(name, label, metric) =
+  variable.query.new(name)
+  + variable.query.generalOptions.withLabel(label)
+  + variable.query.withDatasourceFromVariable(datasource)
+  + variable.query.queryTypes.withLabelValues(name, metric)
+  + variable.query.selectionOptions.withMulti()
+  + variable.query.selectionOptions.withIncludeAll(customAllValue='.+')
+  + variable.query.refresh.onTime();
+
+{
+  grafanaDashboards+:: {
+    [[ quote (printf "%s.json" .Name) ]]:
+      dashboard.new([[ quote .Title ]])
+      + dashboard.withUid([[ quote .UID ]])
+      + dashboard.withDescription('Dashboard created with mixtool.')
+      + dashboard.withEditable(false)
+      + dashboard.time.withFrom('now-1h')
+      + dashboard.withVariables([
+        datasource,
+        labelVariable('job', 'Job', 'up'),
+        labelVariable('instance', 'Instance', 'up{job=~"$job"}'),
+      ])
+      + dashboard.withPanels([
+        timeSeries.new('CPU usage')
+        + timeSeries.panelOptions.withDescription('CPU cores used by each instance.')
+        + timeSeries.panelOptions.withGridPos(h=8, w=24, x=0, y=0)
+        + timeSeries.queryOptions.withDatasource('prometheus', '${datasource}')
+        + timeSeries.queryOptions.withTargets([
+          prometheus.new(
+            '${datasource}',
+            'sum by (instance) (rate(process_cpu_seconds_total{job=~"$job", instance=~"$instance"}[$__rate_interval]))',
+          )
+          + prometheus.withLegendFormat('{{instance}}'),
+        ])
+        + timeSeries.standardOptions.withUnit('short'),
+      ]),
+  },
+}
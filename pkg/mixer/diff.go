@@ -0,0 +1,262 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/rulefmt"
+)
+
+// RulesDiff is the semantic difference between two sets of rule groups.
+type RulesDiff struct {
+	AddedGroups   []string    `json:"added_groups,omitempty"`
+	RemovedGroups []string    `json:"removed_groups,omitempty"`
+	ChangedGroups []GroupDiff `json:"changed_groups,omitempty"`
+}
+
+// GroupDiff is the difference between two versions of a rule group.
+// Rules are named by their alert or record name, followed by their
+// position among the rules of the same name if the name is not unique.
+type GroupDiff struct {
+	Name            string   `json:"name"`
+	SettingsChanged bool     `json:"settings_changed,omitempty"`
+	Reordered       bool     `json:"reordered,omitempty"`
+	AddedRules      []string `json:"added_rules,omitempty"`
+	RemovedRules    []string `json:"removed_rules,omitempty"`
+	ChangedRules    []string `json:"changed_rules,omitempty"`
+}
+
+// DiffRules compares the rule groups in from with the ones in to,
+// ignoring the formatting of the YAML they have been parsed from.
+func DiffRules(from, to []rulefmt.RuleGroup) RulesDiff {
+	var diff RulesDiff
+
+	old := map[string]rulefmt.RuleGroup{}
+	for _, g := range from {
+		old[g.Name] = g
+	}
+	seen := map[string]bool{}
+
+	for _, g := range to {
+		seen[g.Name] = true
+		o, ok := old[g.Name]
+		if !ok {
+			diff.AddedGroups = append(diff.AddedGroups, g.Name)
+			continue
+		}
+		if d := diffRuleGroup(o, g); d != nil {
+			diff.ChangedGroups = append(diff.ChangedGroups, *d)
+		}
+	}
+	for _, g := range from {
+		if !seen[g.Name] {
+			diff.RemovedGroups = append(diff.RemovedGroups, g.Name)
+		}
+	}
+	return diff
+}
+
+// Empty reports whether there are no differences.
+func (d RulesDiff) Empty() bool {
+	return len(d.AddedGroups) == 0 && len(d.RemovedGroups) == 0 && len(d.ChangedGroups) == 0
+}
+
+// String formats the difference with one line per added (+), removed (-)
+// or changed (~) group and rule.
+func (d RulesDiff) String() string {
+	var b strings.Builder
+	for _, g := range d.AddedGroups {
+		fmt.Fprintf(&b, "+ group %s\n", g)
+	}
+	for _, g := range d.RemovedGroups {
+		fmt.Fprintf(&b, "- group %s\n", g)
+	}
+	for _, g := range d.ChangedGroups {
+		fmt.Fprintf(&b, "~ group %s\n", g.Name)
+		if g.SettingsChanged {
+			b.WriteString("  ~ settings\n")
+		}
+		if g.Reordered {
+			b.WriteString("  ~ order of rules\n")
+		}
+		for _, r := range g.AddedRules {
+			fmt.Fprintf(&b, "  + %s\n", r)
+		}
+		for _, r := range g.RemovedRules {
+			fmt.Fprintf(&b, "  - %s\n", r)
+		}
+		for _, r := range g.ChangedRules {
+			fmt.Fprintf(&b, "  ~ %s\n", r)
+		}
+	}
+	return b.String()
+}
+
+// RuleGroupsEqual compares rule groups by their values, ignoring the
+// formatting of the YAML they have been parsed from.
+func RuleGroupsEqual(a, b rulefmt.RuleGroup) bool {
+	return diffRuleGroup(a, b) == nil
+}
+
+// diffRuleGroup returns the difference between the groups,
+// or nil if they are equal.
+func diffRuleGroup(from, to rulefmt.RuleGroup) *GroupDiff {
+	d := GroupDiff{
+		Name:            to.Name,
+		SettingsChanged: from.Interval != to.Interval || from.Limit != to.Limit || !reflect.DeepEqual(from.QueryOffset, to.QueryOffset),
+	}
+
+	old := namedRules(from.Rules)
+	seen := map[string]bool{}
+	for _, r := range namedRuleList(to.Rules) {
+		seen[r.name] = true
+		o, ok := old[r.name]
+		switch {
+		case !ok:
+			d.AddedRules = append(d.AddedRules, r.name)
+		case !reflect.DeepEqual(o, r.rule):
+			d.ChangedRules = append(d.ChangedRules, r.name)
+		}
+	}
+	for _, r := range namedRuleList(from.Rules) {
+		if !seen[r.name] {
+			d.RemovedRules = append(d.RemovedRules, r.name)
+		}
+	}
+
+	if len(d.AddedRules) > 0 || len(d.RemovedRules) > 0 || len(d.ChangedRules) > 0 {
+		return &d
+	}
+
+	// A different order of otherwise equal rules changes the evaluation.
+	for i := range from.Rules {
+		if !reflect.DeepEqual(ruleFromNode(from.Rules[i]), ruleFromNode(to.Rules[i])) {
+			d.Reordered = true
+			break
+		}
+	}
+	if !d.SettingsChanged && !d.Reordered {
+		return nil
+	}
+	return &d
+}
+
+type namedRule struct {
+	name string
+	rule rulefmt.Rule
+}
+
+func namedRuleList(nodes []rulefmt.RuleNode) []namedRule {
+	count := map[string]int{}
+	for _, n := range nodes {
+		count[ruleName(n)]++
+	}
+
+	index := map[string]int{}
+	rules := make([]namedRule, 0, len(nodes))
+	for _, n := range nodes {
+		name := ruleName(n)
+		index[name]++
+		if count[name] > 1 {
+			name = fmt.Sprintf("%s #%d", name, index[name])
+		}
+		rules = append(rules, namedRule{name: name, rule: ruleFromNode(n)})
+	}
+	return rules
+}
+
+func namedRules(nodes []rulefmt.RuleNode) map[string]rulefmt.Rule {
+	rules := map[string]rulefmt.Rule{}
+	for _, r := range namedRuleList(nodes) {
+		rules[r.name] = r.rule
+	}
+	return rules
+}
+
+func ruleName(n rulefmt.RuleNode) string {
+	if n.Alert.Value != "" {
+		return "alert " + n.Alert.Value
+	}
+	return "record " + n.Record.Value
+}
+
+// DashboardsDiff is the difference between two sets of dashboards,
+// named by their filename.
+type DashboardsDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// DiffDashboards compares the dashboards in from with the ones in to,
+// ignoring the formatting of their JSON.
+func DiffDashboards(from, to map[string][]byte) DashboardsDiff {
+	var diff DashboardsDiff
+	for name, dashboard := range to {
+		old, ok := from[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case !jsonEqual(old, dashboard):
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// Empty reports whether there are no differences.
+func (d DashboardsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String formats the difference with one line per added (+), removed (-)
+// or changed (~) dashboard.
+func (d DashboardsDiff) String() string {
+	var b strings.Builder
+	for _, name := range d.Added {
+		fmt.Fprintf(&b, "+ dashboard %s\n", name)
+	}
+	for _, name := range d.Removed {
+		fmt.Fprintf(&b, "- dashboard %s\n", name)
+	}
+	for _, name := range d.Changed {
+		fmt.Fprintf(&b, "~ dashboard %s\n", name)
+	}
+	return b.String()
+}
+
+// jsonEqual compares a and b by their decoded values, or byte by byte if
+// either is not valid JSON.
+func jsonEqual(a, b []byte) bool {
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return string(a) == string(b)
+	}
+	return reflect.DeepEqual(av, bv)
+}
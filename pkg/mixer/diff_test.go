@@ -0,0 +1,138 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseRuleGroups(t *testing.T, content string) []rulefmt.RuleGroup {
+	groups, errs := rulefmt.Parse([]byte(content))
+	if len(errs) > 0 {
+		t.Fatalf("invalid rules: %v", errs)
+	}
+	return groups.Groups
+}
+
+func TestDiffRules(t *testing.T) {
+	from := parseRuleGroups(t, `
+groups:
+- name: unchanged
+  rules:
+  - record: job:up:sum
+    expr: sum by (job) (up)
+- name: changed
+  rules:
+  - alert: Down
+    expr: up == 0
+    labels: {severity: warning}
+  - alert: Down
+    expr: up == 0
+    for: 5m
+    labels: {severity: critical}
+  - record: removed
+    expr: vector(1)
+- name: removed
+  rules: []
+`)
+	to := parseRuleGroups(t, `
+groups:
+- name: unchanged
+  rules:
+  - {record: "job:up:sum", expr: "sum by (job) (up)"}
+- name: changed
+  interval: 1m
+  rules:
+  - alert: Down
+    expr: up == 0
+    labels: {severity: warning}
+  - alert: Down
+    expr: up == 0
+    for: 10m
+    labels: {severity: critical}
+  - record: added
+    expr: vector(1)
+- name: added
+  rules: []
+`)
+
+	diff := DiffRules(from, to)
+	assert.Equal(t, RulesDiff{
+		AddedGroups:   []string{"added"},
+		RemovedGroups: []string{"removed"},
+		ChangedGroups: []GroupDiff{{
+			Name:            "changed",
+			SettingsChanged: true,
+			AddedRules:      []string{"record added"},
+			RemovedRules:    []string{"record removed"},
+			ChangedRules:    []string{"alert Down #2"},
+		}},
+	}, diff)
+	assert.False(t, diff.Empty())
+	assert.Equal(t, `+ group added
+- group removed
+~ group changed
+  ~ settings
+  + record added
+  - record removed
+  ~ alert Down #2
+`, diff.String())
+
+	assert.True(t, DiffRules(from, from).Empty())
+	assert.True(t, RuleGroupsEqual(from[0], to[0]))
+}
+
+func TestDiffRulesOrder(t *testing.T) {
+	from := parseRuleGroups(t, `
+groups:
+- name: g
+  rules:
+  - {record: a, expr: vector(1)}
+  - {record: b, expr: a}
+`)
+	to := parseRuleGroups(t, `
+groups:
+- name: g
+  rules:
+  - {record: b, expr: a}
+  - {record: a, expr: vector(1)}
+`)
+	assert.Equal(t, RulesDiff{ChangedGroups: []GroupDiff{{Name: "g", Reordered: true}}}, DiffRules(from, to))
+}
+
+func TestDiffDashboards(t *testing.T) {
+	from := map[string][]byte{
+		"unchanged.json": []byte(`{"title": "Unchanged", "uid": "a"}`),
+		"changed.json":   []byte(`{"title": "Changed"}`),
+		"removed.json":   []byte(`{"title": "Removed"}`),
+	}
+	to := map[string][]byte{
+		"unchanged.json": []byte(`{"uid":"a","title":"Unchanged"}`),
+		"changed.json":   []byte(`{"title": "Changed again"}`),
+		"added.json":     []byte(`{"title": "Added"}`),
+	}
+
+	diff := DiffDashboards(from, to)
+	assert.Equal(t, DashboardsDiff{
+		Added:   []string{"added.json"},
+		Removed: []string{"removed.json"},
+		Changed: []string{"changed.json"},
+	}, diff)
+	assert.Equal(t, "+ dashboard added.json\n- dashboard removed.json\n~ dashboard changed.json\n", diff.String())
+	assert.True(t, DiffDashboards(from, from).Empty())
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed docs_templates/*.tmpl
+var docsTemplates embed.FS
+
+// DocsFormats are the formats GenerateDocs has built-in templates for.
+var DocsFormats = []string{"markdown", "html"}
+
+// DocsOptions configures GenerateDocs.
+type DocsOptions struct {
+	JPaths []string
+	// Name is the title of the documentation, the name of the directory
+	// of the mixin if empty.
+	Name string
+	// Format is one of DocsFormats, markdown if empty. A Template in html
+	// format is executed as an html/template, escaping its output.
+	Format string
+	// Template is the path to a Go template used instead of the built-in
+	// template of the format. It is executed with a Docs.
+	Template string
+}
+
+// Docs is the documentation of a mixin, given to the docs templates.
+type Docs struct {
+	Name        string
+	AlertGroups []DocsAlertGroup
+	RuleGroups  []DocsRuleGroup
+	Dashboards  []DocsDashboard
+}
+
+// DocsAlertGroup is a group of alerts.
+type DocsAlertGroup struct {
+	Name   string
+	Alerts []DocsAlert
+}
+
+// DocsAlert is an alert. The annotations it is documented by are also
+// available as fields.
+type DocsAlert struct {
+	Name          string
+	Expr          string
+	For           string
+	KeepFiringFor string
+	Labels        map[string]string
+	Annotations   map[string]string
+
+	Severity    string
+	Summary     string
+	Description string
+	RunbookURL  string
+}
+
+// DocsRuleGroup is a group of recording rules.
+type DocsRuleGroup struct {
+	Name     string
+	Interval string
+	Rules    []DocsRecordingRule
+}
+
+// DocsRecordingRule is a recording rule.
+type DocsRecordingRule struct {
+	Record string
+	Expr   string
+	Labels map[string]string
+}
+
+// DocsDashboard is a dashboard, named by its filename.
+type DocsDashboard struct {
+	Filename    string
+	Title       string
+	UID         string
+	Description string
+	Tags        []string
+}
+
+// docsFuncs are the functions available to the docs templates.
+var docsFuncs = map[string]interface{}{
+	"anchor": docsAnchor,
+	"lower":  strings.ToLower,
+	"trim":   strings.TrimSpace,
+	"join":   strings.Join,
+}
+
+// DescribeDocs evaluates the mixin in filename and returns its alerts,
+// recording rules and dashboards for documenting them.
+func DescribeDocs(filename string, opts DocsOptions) (*Docs, error) {
+	vm := NewVM(opts.JPaths)
+
+	docs := &Docs{Name: opts.Name}
+	if docs.Name == "" {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, err
+		}
+		docs.Name = filepath.Base(filepath.Dir(abs))
+	}
+
+	contents, err := evaluateContents(vm, filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range contents.alerts.Groups {
+		group := DocsAlertGroup{Name: g.Name}
+		for _, r := range g.Rules {
+			if r.Alert == "" {
+				continue
+			}
+			group.Alerts = append(group.Alerts, DocsAlert{
+				Name:          r.Alert,
+				Expr:          strings.TrimSpace(r.Expr),
+				For:           r.For,
+				KeepFiringFor: r.KeepFiringFor,
+				Labels:        r.Labels,
+				Annotations:   r.Annotations,
+				Severity:      r.Labels["severity"],
+				Summary:       r.Annotations["summary"],
+				Description:   r.Annotations["description"],
+				RunbookURL:    r.Annotations["runbook_url"],
+			})
+		}
+		docs.AlertGroups = append(docs.AlertGroups, group)
+	}
+	for _, g := range contents.rules.Groups {
+		group := DocsRuleGroup{Name: g.Name, Interval: g.Interval}
+		for _, r := range g.Rules {
+			if r.Record == "" {
+				continue
+			}
+			group.Rules = append(group.Rules, DocsRecordingRule{
+				Record: r.Record,
+				Expr:   strings.TrimSpace(r.Expr),
+				Labels: r.Labels,
+			})
+		}
+		docs.RuleGroups = append(docs.RuleGroups, group)
+	}
+	for _, d := range contents.dashboards {
+		docs.Dashboards = append(docs.Dashboards, DocsDashboard{
+			Filename:    d.Filename,
+			Title:       d.Title,
+			UID:         d.UID,
+			Description: d.Description,
+			Tags:        d.Tags,
+		})
+	}
+
+	return docs, nil
+}
+
+// GenerateDocs renders the documentation of the mixin in filename with the
+// template of opts.
+func GenerateDocs(filename string, opts DocsOptions) ([]byte, error) {
+	if opts.Format == "" {
+		opts.Format = "markdown"
+	}
+	if !isDocsFormat(opts.Format) {
+		return nil, fmt.Errorf("unknown docs format %s, expected one of %s", opts.Format, strings.Join(DocsFormats, ", "))
+	}
+
+	var text []byte
+	var err error
+	if opts.Template != "" {
+		text, err = os.ReadFile(opts.Template)
+	} else {
+		text, err = docsTemplates.ReadFile("docs_templates/" + opts.Format + ".tmpl")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpl interface {
+		Execute(io.Writer, interface{}) error
+	}
+	if opts.Format == "html" {
+		tmpl, err = htmltemplate.New("docs").Funcs(docsFuncs).Parse(string(text))
+	} else {
+		tmpl, err = template.New("docs").Funcs(docsFuncs).Parse(string(text))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse docs template")
+	}
+
+	docs, err := DescribeDocs(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, docs); err != nil {
+		return nil, errors.Wrap(err, "failed to execute docs template")
+	}
+	return out.Bytes(), nil
+}
+
+func isDocsFormat(format string) bool {
+	for _, f := range DocsFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// docsAnchor returns the anchor of a heading like GitHub generates it for
+// markdown, the lowercased heading with spaces replaced by hyphens and
+// other punctuation removed. For an alert it is its lowercased name.
+func docsAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || 'a' <= r && r <= 'z' || '0' <= r && r <= '9':
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
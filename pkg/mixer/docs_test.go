@@ -0,0 +1,137 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDocsJsonnet = `
+{
+  prometheusAlerts+:: {
+    groups+: [{
+      name: 'example',
+      rules: [
+        {
+          alert: 'ExampleDown',
+          expr: 'up{job="example"} == 0\n',
+          'for': '5m',
+          labels: { severity: 'critical' },
+          annotations: {
+            summary: 'Example is down.',
+            description: '{{ $labels.instance }} is <b>down</b>.',
+            runbook_url: 'https://example.com/runbooks#exampledown',
+          },
+        },
+        { alert: 'ExampleSlow', expr: 'vector(1)' },
+      ],
+    }],
+  },
+  prometheusRules+:: {
+    groups+: [{ name: 'example.rules', interval: '1m', rules: [{ record: 'job:up:sum', expr: 'sum by (job) (up)' }] }],
+  },
+  grafanaDashboards+:: {
+    'example.json': { title: 'Example', uid: 'example-uid', description: 'Overview of example.' },
+  },
+}
+`
+
+const expectedDocsMarkdown = "# example-mixin\n" +
+	"\n" +
+	"## Alerts\n" +
+	"\n" +
+	"### example\n" +
+	"\n" +
+	"#### ExampleDown\n" +
+	"\n" +
+	"Example is down.\n" +
+	"\n" +
+	"{{ $labels.instance }} is <b>down</b>.\n" +
+	"\n" +
+	"- Severity: `critical`\n" +
+	"- For: `5m`\n" +
+	"- Runbook: <https://example.com/runbooks#exampledown>\n" +
+	"\n" +
+	"```promql\n" +
+	"up{job=\"example\"} == 0\n" +
+	"```\n" +
+	"\n" +
+	"#### ExampleSlow\n" +
+	"\n" +
+	"```promql\n" +
+	"vector(1)\n" +
+	"```\n" +
+	"\n" +
+	"## Recording rules\n" +
+	"\n" +
+	"### example.rules\n" +
+	"\n" +
+	"Evaluated every `1m`.\n" +
+	"\n" +
+	"#### job:up:sum\n" +
+	"\n" +
+	"```promql\n" +
+	"sum by (job) (up)\n" +
+	"```\n" +
+	"\n" +
+	"## Dashboards\n" +
+	"\n" +
+	"- **Example** (`example.json`, UID `example-uid`): Overview of example.\n"
+
+func TestGenerateDocs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "example-mixin")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	filename := filepath.Join(dir, "mixin.libsonnet")
+	require.NoError(t, os.WriteFile(filename, []byte(testDocsJsonnet), 0644))
+
+	out, err := GenerateDocs(filename, DocsOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, expectedDocsMarkdown, string(out))
+
+	out, err = GenerateDocs(filename, DocsOptions{Format: "html", Name: "Example"})
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "<title>Example</title>")
+	assert.Contains(t, string(out), `<h4 id="exampledown">ExampleDown</h4>`)
+	assert.Contains(t, string(out), "<p>{{ $labels.instance }} is &lt;b&gt;down&lt;/b&gt;.</p>")
+	assert.Contains(t, string(out), `<a href="https://example.com/runbooks#exampledown">`)
+	assert.Contains(t, string(out), "<pre><code>up{job=&#34;example&#34;} == 0</code></pre>")
+
+	template := filepath.Join(t.TempDir(), "runbooks.tmpl")
+	require.NoError(t, os.WriteFile(template, []byte(
+		"{{ range .AlertGroups }}{{ range .Alerts }}{{ anchor .Name }} {{ .Severity }} {{ index .Annotations \"runbook_url\" }}\n{{ end }}{{ end }}",
+	), 0644))
+	out, err = GenerateDocs(filename, DocsOptions{Template: template})
+	require.NoError(t, err)
+	assert.Equal(t, "exampledown critical https://example.com/runbooks#exampledown\nexampleslow  \n", string(out))
+
+	_, err = GenerateDocs(filename, DocsOptions{Format: "pdf"})
+	assert.EqualError(t, err, "unknown docs format pdf, expected one of markdown, html")
+}
+
+func TestDocsAnchor(t *testing.T) {
+	for heading, anchor := range map[string]string{
+		"ExampleDown":       "exampledown",
+		"node.rules":        "noderules",
+		"Recording rules":   "recording-rules",
+		"job:up:sum_rate5m": "jobupsum_rate5m",
+	} {
+		assert.Equal(t, anchor, docsAnchor(heading), heading)
+	}
+}
@@ -73,3 +73,15 @@ else {}
 
 	return vm.EvaluateSnippet("", snippet)
 }
+
+func evaluateConfig(vm *jsonnet.VM, filename string) (string, error) {
+	snippet := fmt.Sprintf(`
+local mixin = (import %q);
+
+if std.objectHasAll(mixin, "_config")
+then mixin._config
+else {}
+`, filename)
+
+	return vm.EvaluateSnippet("", snippet)
+}
@@ -0,0 +1,546 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// DefaultMinSelectorUses is the number of expressions a label matcher is
+// used in at least before Import extracts it into _config.
+const DefaultMinSelectorUses = 2
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	// RuleFiles are Prometheus rule files.
+	RuleFiles []string
+	// DashboardFiles are Grafana dashboards exported as JSON.
+	DashboardFiles []string
+	// MinSelectorUses is the number of expressions a label matcher has to
+	// be used in to be extracted into _config, DefaultMinSelectorUses if 0.
+	MinSelectorUses int
+}
+
+// Import converts Prometheus rule files and Grafana dashboards into the
+// files of a mixin by their path relative to its directory. Groups of
+// alerting rules become its prometheusAlerts, groups with recording rules
+// its prometheusRules and dashboards its grafanaDashboards. Label matchers used in the expressions
+// of the rules and dashboard queries repeatedly are extracted into _config.
+func Import(opts ImportOptions) (map[string][]byte, error) {
+	if opts.MinSelectorUses == 0 {
+		opts.MinSelectorUses = DefaultMinSelectorUses
+	}
+
+	var alertGroups, ruleGroups []rulefmt.RuleGroup
+	for _, filename := range opts.RuleFiles {
+		groups, errs := rulefmt.ParseFile(filename)
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("failed to parse rule file %s: %v", filename, errs[0])
+		}
+		for _, g := range groups.Groups {
+			// A group mixing alerting and recording rules is kept whole
+			// in prometheusRules, as splitting it would repeat its name
+			// and change the order its rules are evaluated in.
+			if onlyAlerts(g) {
+				alertGroups = append(alertGroups, g)
+			} else {
+				ruleGroups = append(ruleGroups, g)
+			}
+		}
+	}
+
+	type dashboard struct {
+		name    string
+		content []byte
+	}
+	var dashboards []dashboard
+	names := map[string]bool{}
+	for _, filename := range opts.DashboardFiles {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(content) {
+			return nil, fmt.Errorf("dashboard %s is not valid JSON", filename)
+		}
+		name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+		if names[name] {
+			return nil, fmt.Errorf("more than one dashboard is named %s", name)
+		}
+		names[name] = true
+		dashboards = append(dashboards, dashboard{name: name, content: content})
+	}
+
+	// Find the matchers of all expressions first, to extract the ones
+	// used repeatedly.
+	selectors := newSelectorExtractor()
+	for _, groups := range [][]rulefmt.RuleGroup{alertGroups, ruleGroups} {
+		for _, g := range groups {
+			for _, r := range g.Rules {
+				selectors.add(r.Expr.Value)
+			}
+		}
+	}
+	for _, d := range dashboards {
+		if err := walkJSONStrings(d.content, "expr", selectors.add); err != nil {
+			return nil, err
+		}
+	}
+	config := selectors.extract(opts.MinSelectorUses)
+
+	files := map[string][]byte{}
+	var imports []string
+	files["config.libsonnet"] = []byte(renderImportConfig(config))
+	imports = append(imports, "config.libsonnet")
+	if len(alertGroups) > 0 {
+		files["alerts/alerts.libsonnet"] = []byte(renderRuleGroups("prometheusAlerts", alertGroups, selectors))
+		imports = append(imports, "alerts/alerts.libsonnet")
+	}
+	if len(ruleGroups) > 0 {
+		files["rules/rules.libsonnet"] = []byte(renderRuleGroups("prometheusRules", ruleGroups, selectors))
+		imports = append(imports, "rules/rules.libsonnet")
+	}
+	if len(dashboards) > 0 {
+		var dashboardImports []string
+		for _, d := range dashboards {
+			var b strings.Builder
+			b.WriteString("{\n  grafanaDashboards+:: {\n    " + jsonnetString(d.name+".json") + ": ")
+			if err := writeJsonnet(&b, d.content, "    ", selectors.rewrite); err != nil {
+				return nil, fmt.Errorf("failed to convert dashboard %s: %w", d.name, err)
+			}
+			b.WriteString(",\n  },\n}\n")
+			files["dashboards/"+d.name+".libsonnet"] = []byte(b.String())
+			dashboardImports = append(dashboardImports, d.name+".libsonnet")
+		}
+		files["dashboards/dashboards.libsonnet"] = []byte(renderImports(dashboardImports))
+		imports = append(imports, "dashboards/dashboards.libsonnet")
+	}
+	files["mixin.libsonnet"] = []byte(renderImports(imports))
+
+	return files, nil
+}
+
+// onlyAlerts returns whether all rules of g are alerting rules.
+func onlyAlerts(g rulefmt.RuleGroup) bool {
+	for _, r := range g.Rules {
+		if r.Alert.Value == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func renderImports(files []string) string {
+	lines := make([]string, 0, len(files))
+	for _, f := range files {
+		lines = append(lines, "(import "+jsonnetString(f)+")")
+	}
+	return strings.Join(lines, " +\n") + "\n"
+}
+
+func renderImportConfig(config map[string]string) string {
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("{\n  _config+:: {\n")
+	for _, k := range keys {
+		b.WriteString("    " + k + ": " + jsonnetString(config[k]) + ",\n")
+	}
+	b.WriteString("  },\n}\n")
+	return b.String()
+}
+
+func renderRuleGroups(field string, groups []rulefmt.RuleGroup, selectors *selectorExtractor) string {
+	var b strings.Builder
+	b.WriteString("{\n  " + field + "+:: {\n    groups+: [\n")
+	for _, g := range groups {
+		b.WriteString("      {\n")
+		b.WriteString("        name: " + jsonnetString(g.Name) + ",\n")
+		if g.Interval != 0 {
+			b.WriteString("        interval: " + jsonnetString(g.Interval.String()) + ",\n")
+		}
+		if g.QueryOffset != nil {
+			b.WriteString("        query_offset: " + jsonnetString(g.QueryOffset.String()) + ",\n")
+		}
+		if g.Limit != 0 {
+			fmt.Fprintf(&b, "        limit: %d,\n", g.Limit)
+		}
+		b.WriteString("        rules: [\n")
+		for _, r := range g.Rules {
+			renderRule(&b, r, selectors, "          ")
+		}
+		b.WriteString("        ],\n      },\n")
+	}
+	b.WriteString("    ],\n  },\n}\n")
+	return b.String()
+}
+
+func renderRule(b *strings.Builder, r rulefmt.RuleNode, selectors *selectorExtractor, indent string) {
+	b.WriteString(indent + "{\n")
+	if r.Alert.Value != "" {
+		b.WriteString(indent + "  alert: " + jsonnetString(r.Alert.Value) + ",\n")
+	} else {
+		b.WriteString(indent + "  record: " + jsonnetString(r.Record.Value) + ",\n")
+	}
+
+	expr, formatted := selectors.rewriteExpr(strings.TrimRight(r.Expr.Value, "\n"))
+	format := ""
+	if formatted {
+		format = " % $._config"
+	}
+	if strings.Contains(expr, "|||") {
+		b.WriteString(indent + "  expr: " + jsonnetString(expr) + format + ",\n")
+	} else {
+		b.WriteString(indent + "  expr: |||\n")
+		for _, l := range strings.Split(expr, "\n") {
+			if l == "" {
+				b.WriteString("\n")
+				continue
+			}
+			b.WriteString(indent + "    " + l + "\n")
+		}
+		b.WriteString(indent + "  |||" + format + ",\n")
+	}
+
+	if r.For != 0 {
+		b.WriteString(indent + "  'for': " + jsonnetString(r.For.String()) + ",\n")
+	}
+	if r.KeepFiringFor != 0 {
+		b.WriteString(indent + "  keep_firing_for: " + jsonnetString(r.KeepFiringFor.String()) + ",\n")
+	}
+	writeStringMap(b, "labels", r.Labels, indent+"  ")
+	writeStringMap(b, "annotations", r.Annotations, indent+"  ")
+	b.WriteString(indent + "},\n")
+}
+
+func writeStringMap(b *strings.Builder, field string, m map[string]string, indent string) {
+	if len(m) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b.WriteString(indent + field + ": {\n")
+	for _, k := range keys {
+		b.WriteString(indent + "  " + jsonnetField(k) + ": " + jsonnetString(m[k]) + ",\n")
+	}
+	b.WriteString(indent + "},\n")
+}
+
+// selectorExtractor finds the label matchers of PromQL expressions and
+// replaces the ones used repeatedly with _config fields.
+type selectorExtractor struct {
+	// uses counts the expressions each matcher is used in.
+	uses map[string]int
+	// names are the _config fields of the extracted matchers.
+	names map[string]string
+}
+
+func newSelectorExtractor() *selectorExtractor {
+	return &selectorExtractor{uses: map[string]int{}}
+}
+
+// add records the matchers of expr.
+func (s *selectorExtractor) add(expr string) {
+	seen := map[string]bool{}
+	for _, m := range findMatchers(expr) {
+		if !seen[m.matcher] {
+			s.uses[m.matcher]++
+			seen[m.matcher] = true
+		}
+	}
+}
+
+// extract names the matchers used in at least minUses expressions and
+// returns them as _config fields.
+func (s *selectorExtractor) extract(minUses int) map[string]string {
+	var matchers []string
+	labels := map[string]int{}
+	for m, uses := range s.uses {
+		if uses >= minUses {
+			matchers = append(matchers, m)
+			labels[matcherLabel(m)]++
+		}
+	}
+	sort.Strings(matchers)
+
+	s.names = map[string]string{}
+	config := map[string]string{}
+	for _, m := range matchers {
+		label := matcherLabel(m)
+		name := lowerFirst(camelCase(label))
+		// Matchers of a label with different values are named by their value.
+		if labels[label] > 1 {
+			name += camelCase(strings.Join(strings.FieldsFunc(matcherValue(m), func(r rune) bool {
+				return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+			}), "_"))
+		}
+		name += "Selector"
+		unique := name
+		for i := 2; config[unique] != ""; i++ {
+			unique = fmt.Sprintf("%s%d", name, i)
+		}
+		s.names[m] = unique
+		config[unique] = m
+	}
+	return config
+}
+
+// rewriteExpr replaces the extracted matchers in expr with the formatting
+// of their _config fields. It returns whether expr has to be formatted
+// with _config, in which case other percent signs are escaped.
+func (s *selectorExtractor) rewriteExpr(expr string) (string, bool) {
+	var b strings.Builder
+	last := 0
+	for _, m := range findMatchers(expr) {
+		name, ok := s.names[m.matcher]
+		if !ok {
+			continue
+		}
+		b.WriteString(strings.ReplaceAll(expr[last:m.start], "%", "%%"))
+		b.WriteString("%(" + name + ")s")
+		last = m.end
+	}
+	if last == 0 {
+		return expr, false
+	}
+	b.WriteString(strings.ReplaceAll(expr[last:], "%", "%%"))
+	return b.String(), true
+}
+
+// rewrite returns the jsonnet of the dashboard query expr, formatted with
+// _config if it uses extracted matchers.
+func (s *selectorExtractor) rewrite(expr string) string {
+	rewritten, formatted := s.rewriteExpr(expr)
+	if !formatted {
+		return jsonnetString(expr)
+	}
+	return jsonnetString(rewritten) + " % $._config"
+}
+
+type matcherPosition struct {
+	matcher    string
+	start, end int
+}
+
+var (
+	// grafanaVariableRegexp matches Grafana variables like $job, ${job} and
+	// $__rate_interval, which are not valid PromQL.
+	grafanaVariableRegexp = regexp.MustCompile(`\$\{[^}]*\}|\$[a-zA-Z0-9_]+`)
+	matcherRegexp         = regexp.MustCompile("([a-zA-Z_][a-zA-Z0-9_]*)\\s*(=~|!~|!=|=)\\s*(\"(?:[^\"\\\\]|\\\\.)*\"|'(?:[^'\\\\]|\\\\.)*'|`[^`]*`)")
+)
+
+// findMatchers returns the label matchers in the selectors of expr, by
+// their position in expr. Matchers of the metric name and using Grafana
+// variables are skipped, as well as expressions that are not valid PromQL.
+func findMatchers(expr string) []matcherPosition {
+	// Replace Grafana variables by durations of the same length, keeping
+	// the positions in the expression.
+	masked := grafanaVariableRegexp.ReplaceAllStringFunc(expr, func(v string) string {
+		return strings.Repeat("0", len(v)-2) + "1s"
+	})
+	node, err := parser.ParseExpr(masked)
+	if err != nil {
+		return nil
+	}
+
+	var matchers []matcherPosition
+	parser.Inspect(node, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		pos := vs.PositionRange()
+		selector := expr[pos.Start:pos.End]
+		open, end := strings.IndexByte(selector, '{'), strings.LastIndexByte(selector, '}')
+		if open < 0 || end < open {
+			return nil
+		}
+		start := int(pos.Start) + open
+		for _, loc := range matcherRegexp.FindAllStringIndex(expr[start:int(pos.Start)+end], -1) {
+			text := expr[start+loc[0] : start+loc[1]]
+			parsed, err := parser.ParseMetricSelector("{" + text + "}")
+			if err != nil || len(parsed) != 1 {
+				continue
+			}
+			m := parsed[0]
+			if m.Name == model.MetricNameLabel || strings.Contains(m.Value, "$") {
+				continue
+			}
+			matchers = append(matchers, matcherPosition{matcher: m.String(), start: start + loc[0], end: start + loc[1]})
+		}
+		return nil
+	})
+	sort.Slice(matchers, func(i, j int) bool { return matchers[i].start < matchers[j].start })
+	return matchers
+}
+
+func matcherLabel(matcher string) string {
+	m, err := parser.ParseMetricSelector("{" + matcher + "}")
+	if err != nil || len(m) != 1 {
+		return ""
+	}
+	return m[0].Name
+}
+
+func matcherValue(matcher string) string {
+	m, err := parser.ParseMetricSelector("{" + matcher + "}")
+	if err != nil || len(m) != 1 {
+		return ""
+	}
+	return m[0].Value
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// walkJSONStrings calls f with the string values of the fields named key
+// anywhere in the JSON data.
+func walkJSONStrings(data []byte, key string, f func(string)) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, value := range v {
+				if s, ok := value.(string); ok && k == key {
+					f(s)
+				}
+				walk(value)
+			}
+		case []interface{}:
+			for _, value := range v {
+				walk(value)
+			}
+		}
+	}
+	walk(v)
+	return nil
+}
+
+// writeJsonnet writes the JSON data as jsonnet, keeping the order of the
+// fields. The values of expr fields are written by rewriteExpr.
+func writeJsonnet(b *strings.Builder, data []byte, indent string, rewriteExpr func(string) string) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var write func(indent, key string) error
+	write = func(indent, key string) error {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case json.Delim:
+			closing := "}"
+			if t == '[' {
+				closing = "]"
+			}
+			if !dec.More() {
+				if _, err := dec.Token(); err != nil {
+					return err
+				}
+				b.WriteString(t.String() + closing)
+				return nil
+			}
+			b.WriteString(t.String() + "\n")
+			for dec.More() {
+				b.WriteString(indent + "  ")
+				field := ""
+				if t == '{' {
+					k, err := dec.Token()
+					if err != nil {
+						return err
+					}
+					field = k.(string)
+					b.WriteString(jsonnetField(field) + ": ")
+				}
+				if err := write(indent+"  ", field); err != nil {
+					return err
+				}
+				b.WriteString(",\n")
+			}
+			if _, err := dec.Token(); err != nil {
+				return err
+			}
+			b.WriteString(indent + closing)
+		case string:
+			if key == "expr" {
+				b.WriteString(rewriteExpr(t))
+			} else {
+				b.WriteString(jsonnetString(t))
+			}
+		case json.Number:
+			b.WriteString(t.String())
+		case bool:
+			fmt.Fprintf(b, "%t", t)
+		case nil:
+			b.WriteString("null")
+		}
+		return nil
+	}
+
+	if err := write(indent, ""); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after the dashboard")
+	}
+	return nil
+}
+
+var (
+	jsonnetIdentifierRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	jsonnetKeywords         = map[string]bool{
+		"assert": true, "else": true, "error": true, "false": true, "for": true, "function": true,
+		"if": true, "import": true, "importstr": true, "importbin": true, "in": true, "local": true,
+		"null": true, "self": true, "super": true, "tailstrict": true, "then": true, "true": true,
+	}
+)
+
+// jsonnetField returns name as the name of a jsonnet field, quoted unless
+// it is an identifier.
+func jsonnetField(name string) string {
+	if jsonnetIdentifierRegexp.MatchString(name) && !jsonnetKeywords[name] {
+		return name
+	}
+	return jsonnetString(name)
+}
@@ -0,0 +1,254 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/rulefmt"
+)
+
+const importRules = `groups:
+- name: node
+  rules:
+  - alert: NodeDown
+    expr: up{job="node"} == 0
+    for: 5m
+    labels:
+      severity: critical
+    annotations:
+      summary: Node is down.
+      description: '{{ $labels.instance }} is down.'
+  - alert: NodeFilesystemFull
+    expr: |
+      node_filesystem_avail_bytes{job="node", fstype!="tmpfs"}
+      /
+      node_filesystem_size_bytes{job="node", fstype!="tmpfs"} * 100 < 5
+    labels:
+      severity: warning
+- name: node.rules
+  interval: 1m
+  rules:
+  - record: instance:node_cpu:rate5m
+    expr: sum by (instance) (rate(node_cpu_seconds_total{job="node",mode!="idle"}[5m]))
+  - record: job:up:sum
+    expr: sum by (job) (up{job='other'})
+  - record: job:up:odd
+    expr: count(up{job="node"} % 2 == 1)
+`
+
+const importDashboard = `{
+  "title": "Node",
+  "uid": "node",
+  "panels": [
+    {
+      "title": "CPU",
+      "type": "timeseries",
+      "targets": [
+        {
+          "expr": "sum by (instance) (rate(node_cpu_seconds_total{job=\"node\", instance=~\"$instance\"}[$__rate_interval]))",
+          "refId": "A"
+        }
+      ]
+    }
+  ],
+  "editable": false,
+  "for": 1.5,
+  "templating": {"list": []}
+}
+`
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	rulesFilename := filepath.Join(dir, "rules.yaml")
+	dashboardFilename := filepath.Join(dir, "node-overview.json")
+	if err := os.WriteFile(rulesFilename, []byte(importRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dashboardFilename, []byte(importDashboard), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Import(ImportOptions{RuleFiles: []string{rulesFilename}, DashboardFiles: []string{dashboardFilename}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	expectedNames := []string{
+		"alerts/alerts.libsonnet",
+		"config.libsonnet",
+		"dashboards/dashboards.libsonnet",
+		"dashboards/node-overview.libsonnet",
+		"mixin.libsonnet",
+		"rules/rules.libsonnet",
+	}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("expected files %v, got %v", expectedNames, names)
+	}
+
+	// Only the matchers used in more than one expression are extracted, the
+	// matchers of Grafana variables never.
+	expectedConfig := `{
+  _config+:: {
+    jobSelector: 'job="node"',
+  },
+}
+`
+	if string(files["config.libsonnet"]) != expectedConfig {
+		t.Errorf("expected config:\n%s\ngot:\n%s", expectedConfig, files["config.libsonnet"])
+	}
+	if !strings.Contains(string(files["alerts/alerts.libsonnet"]), "node_filesystem_avail_bytes{%(jobSelector)s, fstype!=\"tmpfs\"}\n") {
+		t.Errorf("matchers are not extracted in the alerts:\n%s", files["alerts/alerts.libsonnet"])
+	}
+	if !strings.Contains(string(files["rules/rules.libsonnet"]), "count(up{%(jobSelector)s} %% 2 == 1)\n") {
+		t.Errorf("the modulo operator is not escaped in the rules:\n%s", files["rules/rules.libsonnet"])
+	}
+	if !strings.Contains(string(files["dashboards/node-overview.libsonnet"]), `'sum by (instance) (rate(node_cpu_seconds_total{%(jobSelector)s, instance=~"$instance"}[$__rate_interval]))' % $._config`) {
+		t.Errorf("matchers are not extracted in the dashboard:\n%s", files["dashboards/node-overview.libsonnet"])
+	}
+
+	mixinDir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(mixinDir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The mixin evaluates to the imported rules and dashboards.
+	mixin := filepath.Join(mixinDir, "mixin.libsonnet")
+	original, errs := rulefmt.ParseFile(rulesFilename)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	alerts, err := GenerateAlerts(mixin, GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := GenerateRules(mixin, GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated []rulefmt.RuleGroup
+	for _, out := range [][]byte{alerts, rules} {
+		groups, errs := rulefmt.Parse(out)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		generated = append(generated, groups.Groups...)
+	}
+	if diff := DiffRules(original.Groups, generated); !diff.Empty() {
+		t.Errorf("imported rules differ from the original ones:\n%s", diff)
+	}
+
+	dashboards, err := GenerateDashboards(mixin, GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jsonEqual(dashboards["node-overview.json"], []byte(importDashboard)) {
+		t.Errorf("imported dashboard differs from the original one:\n%s", dashboards["node-overview.json"])
+	}
+}
+
+const importMixedRules = `groups:
+- name: app
+  rules:
+  - record: job:errors:rate5m
+    expr: sum by (job) (rate(errors_total[5m]))
+  - alert: AppErrors
+    expr: job:errors:rate5m > 1
+  - record: job:requests:rate5m
+    expr: sum by (job) (rate(requests_total[5m]))
+`
+
+func TestImportMixedGroup(t *testing.T) {
+	rulesFilename := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(rulesFilename, []byte(importMixedRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Import(ImportOptions{RuleFiles: []string{rulesFilename}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["alerts/alerts.libsonnet"]; ok {
+		t.Errorf("expected the mixed group in the rules only, got alerts:\n%s", files["alerts/alerts.libsonnet"])
+	}
+
+	mixinDir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(mixinDir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The group is kept whole, its rules in their original order.
+	out, err := GenerateRulesAlerts(filepath.Join(mixinDir, "mixin.libsonnet"), GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, errs := rulefmt.Parse(out)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	original, errs := rulefmt.ParseFile(rulesFilename)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if diff := DiffRules(original.Groups, groups.Groups); !diff.Empty() {
+		t.Errorf("imported rules differ from the original ones:\n%s", diff)
+	}
+	var order []string
+	for _, r := range groups.Groups[0].Rules {
+		order = append(order, r.Alert.Value+r.Record.Value)
+	}
+	expected := []string{"job:errors:rate5m", "AppErrors", "job:requests:rate5m"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected rules %v, got %v", expected, order)
+	}
+}
+
+func TestFindMatchers(t *testing.T) {
+	expr := `sum(rate(x{job="a", instance=~"$instance"}[$__rate_interval])) / on() { job = 'a' ,__name__="y"} % 2`
+	var matchers []string
+	for _, m := range findMatchers(expr) {
+		matchers = append(matchers, m.matcher+"@"+expr[m.start:m.end])
+	}
+	expected := []string{`job="a"@job="a"`, `job="a"@job = 'a'`}
+	if !reflect.DeepEqual(matchers, expected) {
+		t.Errorf("expected matchers %v, got %v", expected, matchers)
+	}
+
+	if m := findMatchers("invalid{"); m != nil {
+		t.Errorf("expected no matchers for an invalid expression, got %v", m)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+)
+
+// Info summarizes the alerts, recording rules, dashboards and
+// configuration of a mixin.
+type Info struct {
+	AlertGroups []AlertGroupInfo `json:"alert_groups"`
+	RuleGroups  []RuleGroupInfo  `json:"rule_groups"`
+	Dashboards  []DashboardInfo  `json:"dashboards"`
+	Config      []ConfigInfo     `json:"config"`
+}
+
+// AlertGroupInfo is a group of alerts.
+type AlertGroupInfo struct {
+	Name   string      `json:"name"`
+	Alerts []AlertInfo `json:"alerts"`
+}
+
+// AlertInfo is an alert with the value of its severity label, if any.
+type AlertInfo struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity,omitempty"`
+}
+
+// RuleGroupInfo is a group of recording rules, named by the series they
+// record.
+type RuleGroupInfo struct {
+	Name    string   `json:"name"`
+	Records []string `json:"records"`
+}
+
+// DashboardInfo is a dashboard, named by its filename.
+type DashboardInfo struct {
+	Filename string `json:"filename"`
+	Title    string `json:"title,omitempty"`
+	UID      string `json:"uid,omitempty"`
+}
+
+// ConfigInfo is a top-level key of the _config object of a mixin, with its
+// default value as JSON.
+type ConfigInfo struct {
+	Key     string          `json:"key"`
+	Default json.RawMessage `json:"default"`
+}
+
+// mixinGroups are the rule groups of a mixin, as read by Describe and
+// DescribeDocs.
+type mixinGroups struct {
+	Groups []struct {
+		Name     string `json:"name"`
+		Interval string `json:"interval"`
+		Rules    []struct {
+			Alert         string            `json:"alert"`
+			Record        string            `json:"record"`
+			Expr          string            `json:"expr"`
+			For           string            `json:"for"`
+			KeepFiringFor string            `json:"keep_firing_for"`
+			Labels        map[string]string `json:"labels"`
+			Annotations   map[string]string `json:"annotations"`
+		} `json:"rules"`
+	} `json:"groups"`
+}
+
+// mixinDashboard is the subset of a dashboard Describe and DescribeDocs
+// read.
+type mixinDashboard struct {
+	Filename    string   `json:"-"`
+	Title       string   `json:"title"`
+	UID         string   `json:"uid"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+// mixinContents are the alerts, recording rules and dashboards of a mixin.
+type mixinContents struct {
+	alerts     mixinGroups
+	rules      mixinGroups
+	dashboards []mixinDashboard
+}
+
+// evaluateContents evaluates the alerts, recording rules and dashboards of
+// the mixin in filename. The dashboards are sorted by their filename.
+func evaluateContents(vm *jsonnet.VM, filename string) (*mixinContents, error) {
+	var contents mixinContents
+
+	j, err := evaluatePrometheusAlerts(vm, filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(j), &contents.alerts); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal alerts")
+	}
+
+	j, err = evaluatePrometheusRules(vm, filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(j), &contents.rules); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal rules")
+	}
+
+	j, err = evaluateGrafanaDashboards(vm, filename)
+	if err != nil {
+		return nil, err
+	}
+	var dashboards map[string]mixinDashboard
+	if err := json.Unmarshal([]byte(j), &dashboards); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal dashboards")
+	}
+	for name, d := range dashboards {
+		d.Filename = name
+		contents.dashboards = append(contents.dashboards, d)
+	}
+	sort.Slice(contents.dashboards, func(i, j int) bool { return contents.dashboards[i].Filename < contents.dashboards[j].Filename })
+
+	return &contents, nil
+}
+
+// Describe evaluates the mixin in filename and summarizes its contents.
+func Describe(filename string, opts GenerateOptions) (*Info, error) {
+	vm := NewVM(opts.JPaths)
+	info := &Info{
+		AlertGroups: []AlertGroupInfo{},
+		RuleGroups:  []RuleGroupInfo{},
+		Dashboards:  []DashboardInfo{},
+		Config:      []ConfigInfo{},
+	}
+
+	contents, err := evaluateContents(vm, filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range contents.alerts.Groups {
+		group := AlertGroupInfo{Name: g.Name, Alerts: []AlertInfo{}}
+		for _, r := range g.Rules {
+			if r.Alert != "" {
+				group.Alerts = append(group.Alerts, AlertInfo{Name: r.Alert, Severity: r.Labels["severity"]})
+			}
+		}
+		info.AlertGroups = append(info.AlertGroups, group)
+	}
+	for _, g := range contents.rules.Groups {
+		group := RuleGroupInfo{Name: g.Name, Records: []string{}}
+		for _, r := range g.Rules {
+			if r.Record != "" {
+				group.Records = append(group.Records, r.Record)
+			}
+		}
+		info.RuleGroups = append(info.RuleGroups, group)
+	}
+	for _, d := range contents.dashboards {
+		info.Dashboards = append(info.Dashboards, DashboardInfo{Filename: d.Filename, Title: d.Title, UID: d.UID})
+	}
+
+	j, err := evaluateConfig(vm, filename)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(j), &config); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal config")
+	}
+	for key, value := range config {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, value); err != nil {
+			return nil, err
+		}
+		info.Config = append(info.Config, ConfigInfo{Key: key, Default: compact.Bytes()})
+	}
+	sort.Slice(info.Config, func(i, j int) bool { return info.Config[i].Key < info.Config[j].Key })
+
+	return info, nil
+}
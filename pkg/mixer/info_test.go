@@ -0,0 +1,73 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testInfoJsonnet = `
+{
+  _config+:: {
+    selector: 'job="example"',
+    thresholds: { critical: 90 },
+  },
+  prometheusAlerts+:: {
+    groups+: [{
+      name: 'example',
+      rules: [
+        { alert: 'ExampleDown', expr: 'up{%(selector)s} == 0' % $._config, labels: { severity: 'critical' } },
+        { alert: 'ExampleSlow', expr: 'vector(1)' },
+      ],
+    }],
+  },
+  prometheusRules+:: {
+    groups+: [{ name: 'example.rules', rules: [{ record: 'job:up:sum', expr: 'sum by (job) (up)' }] }],
+  },
+  grafanaDashboards+:: {
+    'example.json': { title: 'Example', uid: 'example-uid' },
+  },
+}
+`
+
+func TestDescribe(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mixin.libsonnet")
+	require.NoError(t, os.WriteFile(filename, []byte(testInfoJsonnet), 0644))
+
+	info, err := Describe(filename, GenerateOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, &Info{
+		AlertGroups: []AlertGroupInfo{{
+			Name: "example",
+			Alerts: []AlertInfo{
+				{Name: "ExampleDown", Severity: "critical"},
+				{Name: "ExampleSlow"},
+			},
+		}},
+		RuleGroups: []RuleGroupInfo{{Name: "example.rules", Records: []string{"job:up:sum"}}},
+		Dashboards: []DashboardInfo{{Filename: "example.json", Title: "Example", UID: "example-uid"}},
+		Config: []ConfigInfo{
+			{Key: "selector", Default: json.RawMessage(`"job=\"example\""`)},
+			{Key: "thresholds", Default: json.RawMessage(`{"critical":90}`)},
+		},
+	}, info)
+}
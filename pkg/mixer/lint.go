@@ -18,8 +18,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
 	"path"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"text/template"
 
 	"github.com/fatih/color"
 	"github.com/google/go-jsonnet"
@@ -31,6 +36,19 @@ type LintOptions struct {
 	JPaths     []string
 	Grafana    bool
 	Prometheus bool
+
+	// RunbookURL requires every alert to have a runbook_url annotation
+	// with an http or https URL.
+	RunbookURL bool
+	// RunbookURLPattern is a Go template of a regular expression the
+	// runbook_url of an alert has to match, like '#{{ lower .Alert }}$'.
+	// It is given the Alert and Group name and can use the functions lower
+	// and quote, which escapes regular expression metacharacters.
+	RunbookURLPattern string
+	// RunbookDirectory is a local directory that has to contain a runbook
+	// of every alert, a file named after the lowercased alert name with any
+	// extension.
+	RunbookDirectory string
 }
 
 func Lint(w io.Writer, filename string, options LintOptions) error {
@@ -39,7 +57,7 @@ func Lint(w io.Writer, filename string, options LintOptions) error {
 	if options.Prometheus {
 		vm := NewVM(options.JPaths)
 		errs := make(chan error)
-		go lintPrometheus(filename, vm, errs)
+		go lintPrometheus(filename, vm, options, errs)
 		errCount += printErrs(w, errs)
 	}
 
@@ -65,9 +83,19 @@ func printErrs(w io.Writer, errs <-chan error) int {
 	return errCount
 }
 
-func lintPrometheus(filename string, vm *jsonnet.VM, errsOut chan<- error) {
+func lintPrometheus(filename string, vm *jsonnet.VM, options LintOptions, errsOut chan<- error) {
 	defer close(errsOut)
 
+	var runbooks *runbookLinter
+	if options.RunbookURL {
+		var err error
+		runbooks, err = newRunbookLinter(options.RunbookURLPattern, options.RunbookDirectory)
+		if err != nil {
+			errsOut <- err
+			return
+		}
+	}
+
 	// Lint using the config file from grafana/dashboard-linter
 	config := lint.NewConfigurationFile()
 	configFilename := path.Join(path.Dir(filename), ".lint")
@@ -92,6 +120,9 @@ func lintPrometheus(filename string, vm *jsonnet.VM, errsOut chan<- error) {
 		}
 		for _, r := range g.Rules {
 			errs = lintPrometheusAlertsGuidelines(&r, config)
+			if runbooks != nil && r.Alert.Value != "" {
+				errs = append(errs, runbooks.lint(g.Name, &r, config)...)
+			}
 			for _, err := range errs {
 				errsOut <- err
 			}
@@ -179,6 +210,94 @@ func lintPrometheusAlertsGuidelines(rule *rulefmt.RuleNode, cf *lint.Configurati
 	return errs
 }
 
+// runbookLinter enforces the opt-in runbook_url guidelines.
+type runbookLinter struct {
+	pattern *template.Template
+	dir     string
+	// runbooks are the lowercased names of the files in dir without their
+	// extension.
+	runbooks map[string]bool
+}
+
+func newRunbookLinter(pattern, dir string) (*runbookLinter, error) {
+	l := &runbookLinter{dir: dir}
+	if pattern != "" {
+		t, err := template.New("runbook_url").Funcs(template.FuncMap{
+			"lower": strings.ToLower,
+			"quote": regexp.QuoteMeta,
+		}).Parse(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid runbook URL pattern: %v", err)
+		}
+		l.pattern = t
+	}
+	if dir != "" {
+		l.runbooks = map[string]bool{}
+		err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				name := d.Name()
+				l.runbooks[strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read runbook directory: %v", err)
+		}
+	}
+	return l, nil
+}
+
+// lint checks that the alert in group has a well-formed runbook_url matching
+// the pattern, and a runbook in the runbook directory.
+func (l *runbookLinter) lint(group string, rule *rulefmt.RuleNode, cf *lint.ConfigurationFile) (errs []error) {
+	alert := rule.Alert.Value
+
+	if runbookURL, ok := rule.Annotations["runbook_url"]; !ok {
+		if !isLintExcluded("alert-runbook-url-missing-rule", alert, cf) {
+			errs = append(errs, fmt.Errorf("[alert-runbook-url-missing-rule] Alert '%s' must have annotation 'runbook_url'", alert))
+		}
+	} else {
+		if !isLintExcluded("alert-runbook-url-format", alert, cf) {
+			u, err := url.Parse(runbookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("[alert-runbook-url-format] Alert %s annotation 'runbook_url' must be an http or https URL, is currently '%s'", alert, runbookURL))
+			}
+		}
+		if l.pattern != nil && !isLintExcluded("alert-runbook-url-pattern", alert, cf) {
+			if err := l.matchPattern(group, alert, runbookURL); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if l.runbooks != nil && !isLintExcluded("alert-runbook-file-missing", alert, cf) {
+		if !l.runbooks[strings.ToLower(alert)] {
+			errs = append(errs, fmt.Errorf("[alert-runbook-file-missing] Alert '%s' has no runbook in %s, expected a file named '%s' with any extension", alert, l.dir, strings.ToLower(alert)))
+		}
+	}
+	return errs
+}
+
+// matchPattern checks that runbookURL matches the pattern rendered for the
+// alert.
+func (l *runbookLinter) matchPattern(group, alert, runbookURL string) error {
+	var pattern strings.Builder
+	if err := l.pattern.Execute(&pattern, struct{ Alert, Group string }{alert, group}); err != nil {
+		return fmt.Errorf("[alert-runbook-url-pattern] Alert %s: invalid runbook URL pattern: %v", alert, err)
+	}
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return fmt.Errorf("[alert-runbook-url-pattern] Alert %s: invalid runbook URL pattern: %v", alert, err)
+	}
+	if !re.MatchString(runbookURL) {
+		return fmt.Errorf("[alert-runbook-url-pattern] Alert %s annotation 'runbook_url' must match '%s', is currently '%s'", alert, pattern.String(), runbookURL)
+	}
+	return nil
+}
+
 func lintGrafanaDashboards(filename string, vm *jsonnet.VM, errsOut chan<- error) {
 	defer close(errsOut)
 
@@ -15,8 +15,11 @@
 package mixer
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/google/go-jsonnet"
@@ -34,7 +37,7 @@ func TestLintPrometheusAlerts(t *testing.T) {
 
 	vm := jsonnet.MakeVM()
 	errs := make(chan error)
-	go lintPrometheus(filename, vm, errs)
+	go lintPrometheus(filename, vm, LintOptions{}, errs)
 	for err := range errs {
 		t.Errorf("linting wrote unexpected output: %v", err)
 	}
@@ -270,7 +273,7 @@ func TestLintPrometheusAlertsGuidelines(t *testing.T) {
 
 		vm := jsonnet.MakeVM()
 		errs := make(chan error)
-		go lintPrometheus(filename, vm, errs)
+		go lintPrometheus(filename, vm, LintOptions{}, errs)
 		for err := range errs {
 			if err.Error() != alertTest.expectedLintErr {
 				t.Errorf("linting wrote unexpected output, expected '%s', got: %v", alertTest.expectedLintErr, err)
@@ -316,7 +319,7 @@ func TestLintPrometheusAlertGroupsGuidelines_ValidGroup(t *testing.T) {
 
 	vm := jsonnet.MakeVM()
 	errs := make(chan error)
-	go lintPrometheus(filename, vm, errs)
+	go lintPrometheus(filename, vm, LintOptions{}, errs)
 	for err := range errs {
 		if err.Error() != expectedLintErr {
 			t.Errorf("linting wrote unexpected output, expected '%s', got: %v", expectedLintErr, err)
@@ -360,7 +363,7 @@ func TestLintPrometheusAlertGroupsGuidelines_InvalidGroupName(t *testing.T) {
 
 	vm := jsonnet.MakeVM()
 	errs := make(chan error)
-	go lintPrometheus(filename, vm, errs)
+	go lintPrometheus(filename, vm, LintOptions{}, errs)
 	for err := range errs {
 		if err.Error() != expectedLintErr {
 			t.Errorf("linting wrote unexpected output, expected '%s', got: %v", expectedLintErr, err)
@@ -413,7 +416,7 @@ func TestLintPrometheusAlertGroupsGuidelines_TooManyAlerts(t *testing.T) {
 
 	vm := jsonnet.MakeVM()
 	errs := make(chan error)
-	go lintPrometheus(filename, vm, errs)
+	go lintPrometheus(filename, vm, LintOptions{}, errs)
 	for err := range errs {
 		if err.Error() != expectedLintErr {
 			t.Errorf("linting wrote unexpected output, expected '%s', got: %v", expectedLintErr, err)
@@ -421,13 +424,108 @@ func TestLintPrometheusAlertGroupsGuidelines_TooManyAlerts(t *testing.T) {
 	}
 }
 
+func TestLintPrometheusAlertsRunbook(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "testalert.md"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := LintOptions{
+		RunbookURL:        true,
+		RunbookURLPattern: `^https://runbooks\.example\.com/{{ .Group }}\.md#{{ lower .Alert | quote }}$`,
+		RunbookDirectory:  dir,
+	}
+
+	for _, tc := range []struct {
+		alert           string
+		runbookURL      string
+		expectedLintErr []string
+	}{
+		{
+			alert:      "TestAlert",
+			runbookURL: "https://runbooks.example.com/test.md#testalert",
+		},
+		{
+			alert: "TestAlert",
+			expectedLintErr: []string{
+				"[alert-runbook-url-missing-rule] Alert 'TestAlert' must have annotation 'runbook_url'",
+			},
+		},
+		{
+			alert:      "TestAlert",
+			runbookURL: "runbooks/test.md#testalert",
+			expectedLintErr: []string{
+				"[alert-runbook-url-format] Alert TestAlert annotation 'runbook_url' must be an http or https URL, is currently 'runbooks/test.md#testalert'",
+				`[alert-runbook-url-pattern] Alert TestAlert annotation 'runbook_url' must match '^https://runbooks\.example\.com/test\.md#testalert$', is currently 'runbooks/test.md#testalert'`,
+			},
+		},
+		{
+			alert:      "OtherAlert",
+			runbookURL: "https://runbooks.example.com/test.md#otheralert",
+			expectedLintErr: []string{
+				fmt.Sprintf("[alert-runbook-file-missing] Alert 'OtherAlert' has no runbook in %s, expected a file named 'otheralert' with any extension", dir),
+			},
+		},
+	} {
+		annotations := map[string]string{
+			"description": "{{ $labels.instance }} is down.",
+			"summary":     "Instance is down.",
+		}
+		if tc.runbookURL != "" {
+			annotations["runbook_url"] = tc.runbookURL
+		}
+		alerts, err := json.Marshal(map[string]interface{}{
+			"prometheusAlerts": map[string]interface{}{
+				"groups": []interface{}{map[string]interface{}{
+					"name": "test",
+					"rules": []interface{}{map[string]interface{}{
+						"alert":       tc.alert,
+						"expr":        "up == 0",
+						"labels":      map[string]string{"severity": "warning"},
+						"annotations": annotations,
+					}},
+				}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filename, delete := writeTempFile(t, "alerts.jsonnet", string(alerts))
+		defer delete()
+
+		vm := jsonnet.MakeVM()
+		errs := make(chan error)
+		go lintPrometheus(filename, vm, options, errs)
+		var lintErrs []string
+		for err := range errs {
+			lintErrs = append(lintErrs, err.Error())
+		}
+		if !reflect.DeepEqual(lintErrs, tc.expectedLintErr) {
+			t.Errorf("linting alert %s with runbook_url '%s' wrote unexpected output, expected %q, got %q", tc.alert, tc.runbookURL, tc.expectedLintErr, lintErrs)
+		}
+	}
+
+	// The rule is opt-in.
+	filename, delete := writeTempFile(t, "alerts.jsonnet", `{ prometheusAlerts: { groups: [{ name: 'test', rules: [{ alert: 'TestAlert', expr: 'up == 0', labels: { severity: 'warning' }, annotations: { description: '{{ $value }}', summary: 'Down.' } }] }] } }`)
+	defer delete()
+	errs := make(chan error)
+	go lintPrometheus(filename, jsonnet.MakeVM(), LintOptions{}, errs)
+	for err := range errs {
+		t.Errorf("linting without runbook options wrote unexpected output: %v", err)
+	}
+
+	if _, err := newRunbookLinter("{{ .Alert", ""); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
 func TestLintPrometheusRules(t *testing.T) {
 	filename, delete := writeTempFile(t, "rules.jsonnet", rules)
 	defer delete()
 
 	vm := jsonnet.MakeVM()
 	errs := make(chan error)
-	go lintPrometheus(filename, vm, errs)
+	go lintPrometheus(filename, vm, LintOptions{}, errs)
 	for err := range errs {
 		t.Errorf("linting wrote unexpected output: %v", err)
 	}
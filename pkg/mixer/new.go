@@ -14,55 +14,143 @@
 
 package mixer
 
-const dashboard = `local grafana = import 'grafonnet/grafana.libsonnet';
-local dashboard = grafana.dashboard;
-local row = grafana.row;
-local prometheus = grafana.prometheus;
-local graphPanel = grafana.graphPanel;
-
-{
-  grafanaDashboards+:: {
-    'dashboard.json':
-      dashboard.new(
-        'New Dashboard',
-        time_from='now-1h',
-      ).addTemplate(
-        {
-          current: {
-            text: 'Prometheus',
-            value: 'Prometheus',
-          },
-          hide: 0,
-          label: null,
-          name: 'datasource',
-          options: [],
-          query: 'prometheus',
-          refresh: 1,
-          regex: '',
-          type: 'datasource',
-        },
-      )
-      .addRow(
-        row.new()
-        .addPanel(
-          graphPanel.new(
-            'Graph',
-            datasource='$datasource',
-            span=6,
-            format='short',
-          )
-          .addTarget(prometheus.target(
-            'node_cpu{%(nodeExporterSelector)s, mode!="idle"})' % $._config,
-            legendFormat='{{cpu}}'
-          ))
-        )
-      ),
-  },
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//go:embed dashboard_templates/*.libsonnet
+var dashboardTemplates embed.FS
+
+// DefaultDashboardTemplate is the template of NewGrafanaDashboard if none
+// is given.
+const DefaultDashboardTemplate = "timeseries"
+
+// maxDashboardUIDLength is the longest UID Grafana accepts.
+const maxDashboardUIDLength = 40
+
+// DashboardOptions configures a new Grafana dashboard.
+type DashboardOptions struct {
+	// Template is the name of the template to use.
+	Template string
+	// TemplateDirectory holds additional templates, named after their
+	// file without the .libsonnet extension. They take precedence over
+	// the built-in templates.
+	TemplateDirectory string
+
+	// Name is the file name of the dashboard, without the .json extension.
+	Name  string
+	Title string
+	UID   string
 }
-`
 
-func NewGrafanaDashboard() ([]byte, error) {
-	return []byte(dashboard), nil
+// NewGrafanaDashboard returns a jsonnet file adding a Grafana dashboard to
+// the grafanaDashboards of a mixin. Templates are Go templates delimited by
+// [[ and ]], which are given the Name, Title and UID of the dashboard and a
+// quote function turning a string into a jsonnet string.
+func NewGrafanaDashboard(opts DashboardOptions) ([]byte, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("no dashboard name given")
+	}
+	if opts.Template == "" {
+		opts.Template = DefaultDashboardTemplate
+	}
+	if opts.Title == "" {
+		opts.Title = opts.Name
+	}
+	if opts.UID == "" {
+		opts.UID = opts.Name
+	}
+	if len(opts.UID) > maxDashboardUIDLength {
+		return nil, fmt.Errorf("dashboard UID %q is longer than %d characters", opts.UID, maxDashboardUIDLength)
+	}
+
+	content, err := readDashboardTemplate(opts.Template, opts.TemplateDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(opts.Template).
+		Delims("[[", "]]").
+		Funcs(template.FuncMap{"quote": quoteJsonnet}).
+		Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dashboard template %s: %w", opts.Template, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, opts); err != nil {
+		return nil, fmt.Errorf("failed to execute dashboard template %s: %w", opts.Template, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DashboardTemplates returns the names of the built-in dashboard templates
+// and the ones in dir, if any.
+func DashboardTemplates(dir string) ([]string, error) {
+	names := map[string]bool{}
+	builtin, err := fs.Glob(dashboardTemplates, "dashboard_templates/*.libsonnet")
+	if err != nil {
+		return nil, err
+	}
+	for _, filename := range builtin {
+		names[strings.TrimSuffix(path.Base(filename), ".libsonnet")] = true
+	}
+
+	if dir != "" {
+		custom, err := filepath.Glob(filepath.Join(dir, "*.libsonnet"))
+		if err != nil {
+			return nil, err
+		}
+		for _, filename := range custom {
+			names[strings.TrimSuffix(filepath.Base(filename), ".libsonnet")] = true
+		}
+	}
+
+	templates := make([]string, 0, len(names))
+	for name := range names {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+	return templates, nil
+}
+
+func readDashboardTemplate(name, dir string) ([]byte, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid dashboard template name %q", name)
+	}
+
+	if dir != "" {
+		content, err := os.ReadFile(filepath.Join(dir, name+".libsonnet"))
+		if err == nil {
+			return content, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	content, err := dashboardTemplates.ReadFile("dashboard_templates/" + name + ".libsonnet")
+	if err != nil {
+		templates, _ := DashboardTemplates(dir)
+		return nil, fmt.Errorf("unknown dashboard template %q, expected one of %s", name, strings.Join(templates, ", "))
+	}
+	return content, nil
+}
+
+// quoteJsonnet returns s as a jsonnet string. JSON strings are valid jsonnet.
+func quoteJsonnet(s string) (string, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
 }
 
 const alerts = `{
@@ -120,3 +208,68 @@ const rules = `{
 func NewPrometheusRules() ([]byte, error) {
 	return []byte(rules), nil
 }
+
+//go:embed all:scaffold
+var scaffold embed.FS
+
+var mixinNameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// maxMixinNameLength keeps the names of the alerts, groups and dashboards
+// derived from the mixin name within the limits of Lint.
+const maxMixinNameLength = 31
+
+// NewMixin returns the files of a new mixin project called name by their
+// path relative to the project directory. The project has alerts, rules and
+// a dashboard that pass Lint, once its jsonnet-bundler dependencies are
+// installed.
+func NewMixin(name string) (map[string][]byte, error) {
+	if !mixinNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid mixin name %q, it must start with a letter and only contain letters, digits, '-' and '_'", name)
+	}
+	if len(name) > maxMixinNameLength {
+		return nil, fmt.Errorf("invalid mixin name %q, it must not be longer than %d characters", name, maxMixinNameLength)
+	}
+
+	data := struct {
+		Name        string
+		AlertPrefix string
+	}{
+		Name:        name,
+		AlertPrefix: camelCase(name),
+	}
+
+	files := map[string][]byte{}
+	err := fs.WalkDir(scaffold, "scaffold", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := scaffold.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(p).Delims("[[", "]]").Parse(string(content))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return err
+		}
+		files[strings.TrimPrefix(p, "scaffold/")] = buf.Bytes()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// camelCase turns a mixin name like node_exporter or my-app into NodeExporter
+// or MyApp.
+func camelCase(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
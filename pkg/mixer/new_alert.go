@@ -0,0 +1,338 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/grafana/dashboard-linter/lint"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"gopkg.in/yaml.v3"
+)
+
+// Alert is a Prometheus alert added to a file by AddPrometheusAlert.
+type Alert struct {
+	Group       string
+	Name        string
+	Expr        string
+	For         string
+	Severity    string
+	Summary     string
+	Description string
+}
+
+// ValidateAlert checks that the alert is a valid Prometheus alert following
+// the guidelines enforced by Lint. Like Lint, it skips the rules excluded by
+// the .lint file in dir.
+func ValidateAlert(a Alert, dir string) []error {
+	config := lint.NewConfigurationFile()
+	if err := config.Load(path.Join(dir, ".lint")); err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	if a.Group == "" {
+		errs = append(errs, fmt.Errorf("no alert group given"))
+	}
+
+	rule := rulefmt.RuleNode{
+		Alert:  yaml.Node{Kind: yaml.ScalarNode, Value: a.Name},
+		Expr:   yaml.Node{Kind: yaml.ScalarNode, Value: a.Expr},
+		Labels: map[string]string{"severity": a.Severity},
+	}
+	if a.For != "" {
+		d, err := model.ParseDuration(a.For)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid duration of alert '%s': %v", a.Name, err))
+		}
+		rule.For = d
+	}
+	if a.Summary != "" || a.Description != "" {
+		rule.Annotations = map[string]string{}
+	}
+	if a.Summary != "" {
+		rule.Annotations["summary"] = a.Summary
+	}
+	if a.Description != "" {
+		rule.Annotations["description"] = a.Description
+	}
+
+	for _, err := range rule.Validate() {
+		errs = append(errs, err.Unwrap())
+	}
+	group := rulefmt.RuleGroup{Name: a.Group, Rules: []rulefmt.RuleNode{rule}}
+	errs = append(errs, lintPrometheusAlertGroups(&group, config)...)
+	errs = append(errs, lintPrometheusAlertsGuidelines(&rule, config)...)
+	return errs
+}
+
+// AddPrometheusAlert adds the alert to its group in the prometheusAlerts of
+// the jsonnet in content, adding the group if it does not exist yet. The
+// alert is inserted into the existing text, keeping its formatting. If
+// content is empty, it returns a new file with the alert.
+func AddPrometheusAlert(filename string, content []byte, a Alert) ([]byte, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return []byte(renderAlertsFile(a)), nil
+	}
+
+	node, err := jsonnet.SnippetToAST(filename, string(content))
+	if err != nil {
+		return nil, err
+	}
+	groups := findAlertGroups(node)
+	if groups == nil {
+		return nil, fmt.Errorf("no list of groups in prometheusAlerts found in %s", filename)
+	}
+
+	for _, el := range groups.Elements {
+		group, ok := el.Expr.(*ast.DesugaredObject)
+		if !ok {
+			continue
+		}
+		name, ok := objectField(group, "name").(*ast.LiteralString)
+		if !ok || name.Value != a.Group {
+			continue
+		}
+		rules, ok := objectField(group, "rules").(*ast.Array)
+		if !ok {
+			return nil, fmt.Errorf("the rules of group %s in %s are not a list", a.Group, filename)
+		}
+		for _, r := range rules.Elements {
+			if rule, ok := r.Expr.(*ast.DesugaredObject); ok {
+				if alert, ok := objectField(rule, "alert").(*ast.LiteralString); ok && alert.Value == a.Name {
+					return nil, fmt.Errorf("alert %s already exists in group %s of %s", a.Name, a.Group, filename)
+				}
+			}
+		}
+		return appendElement(content, rules, func(indent string) string {
+			return renderAlert(a, indent)
+		}), nil
+	}
+
+	return appendElement(content, groups, func(indent string) string {
+		return renderAlertGroup(a, indent)
+	}), nil
+}
+
+// findAlertGroups returns the array of groups in the prometheusAlerts of
+// node, looking into the operands of the mixins added to each other.
+func findAlertGroups(node ast.Node) *ast.Array {
+	switch n := node.(type) {
+	case *ast.Local:
+		return findAlertGroups(n.Body)
+	case *ast.Parens:
+		return findAlertGroups(n.Inner)
+	case *ast.Binary:
+		if groups := findAlertGroups(n.Right); groups != nil {
+			return groups
+		}
+		return findAlertGroups(n.Left)
+	case *ast.DesugaredObject:
+		alerts, ok := objectField(n, "prometheusAlerts").(*ast.DesugaredObject)
+		if !ok {
+			return nil
+		}
+		groups, _ := objectField(alerts, "groups").(*ast.Array)
+		return groups
+	}
+	return nil
+}
+
+// objectField returns the body of the field of o with a literal name, or nil.
+func objectField(o *ast.DesugaredObject, name string) ast.Node {
+	for _, f := range o.Fields {
+		if s, ok := f.Name.(*ast.LiteralString); ok && s.Value == name {
+			return f.Body
+		}
+	}
+	return nil
+}
+
+// appendElement inserts the element rendered by render after the last
+// element of arr in content, indented like it.
+func appendElement(content []byte, arr *ast.Array, render func(indent string) string) []byte {
+	text := string(content)
+	end := offset(text, arr.Loc().End)
+
+	if len(arr.Elements) == 0 {
+		// Insert before the closing bracket.
+		begin := offset(text, arr.Loc().Begin)
+		indent := lineIndent(text, begin)
+		closing := strings.LastIndex(text[:end], "]")
+		return []byte(text[:closing] + "\n" + render(indent+"  ") + "\n" + indent + text[closing:])
+	}
+
+	last := arr.Elements[len(arr.Elements)-1].Expr
+	indent := lineIndent(text, offset(text, last.Loc().Begin))
+	lastEnd := offset(text, last.Loc().End)
+
+	comma := ","
+	pos := lastEnd
+	if rest := strings.TrimLeft(text[pos:], " \t"); strings.HasPrefix(rest, ",") {
+		comma = ""
+		pos = len(text) - len(rest) + 1
+	}
+	// Keep a comment following the last element on its line.
+	lineEnd := len(text)
+	if i := strings.IndexByte(text[pos:], '\n'); i >= 0 {
+		lineEnd = pos + i
+	}
+	if c := strings.TrimSpace(text[pos:lineEnd]); strings.HasPrefix(c, "//") || strings.HasPrefix(c, "#") {
+		pos = lineEnd
+	}
+	return []byte(text[:lastEnd] + comma + text[lastEnd:pos] + "\n" + render(indent) + text[pos:])
+}
+
+// offset returns the byte offset of the location in text. Columns of
+// jsonnet locations count characters.
+func offset(text string, loc ast.Location) int {
+	pos := 0
+	for line := 1; line < loc.Line; line++ {
+		i := strings.IndexByte(text[pos:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		pos += i + 1
+	}
+	for column := 1; column < loc.Column && pos < len(text); column++ {
+		_, size := utf8.DecodeRuneInString(text[pos:])
+		pos += size
+	}
+	return pos
+}
+
+// lineIndent returns the leading whitespace of the line containing pos.
+func lineIndent(text string, pos int) string {
+	start := strings.LastIndexByte(text[:pos], '\n') + 1
+	line := text[start:]
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+func renderAlertsFile(a Alert) string {
+	return "{\n" +
+		"  prometheusAlerts+:: {\n" +
+		"    groups+: [\n" +
+		renderAlertGroup(a, "      ") + "\n" +
+		"    ],\n" +
+		"  },\n" +
+		"}\n"
+}
+
+// renderAlertGroup returns the jsonnet of a group with only the alert,
+// indented by indent and followed by a comma.
+func renderAlertGroup(a Alert, indent string) string {
+	return indentLines([]string{"{", "  name: " + jsonnetString(a.Group) + ",", "  rules: ["}, indent) + "\n" +
+		renderAlert(a, indent+"    ") + "\n" +
+		indentLines([]string{"  ],", "},"}, indent)
+}
+
+// renderAlert returns the jsonnet of the alert, indented by indent and
+// followed by a comma.
+func renderAlert(a Alert, indent string) string {
+	lines := []string{
+		"{",
+		"  alert: " + jsonnetString(a.Name) + ",",
+	}
+	if strings.Contains(a.Expr, "|||") {
+		lines = append(lines, "  expr: "+jsonnetString(a.Expr)+",")
+	} else {
+		lines = append(lines, "  expr: |||")
+		for _, l := range strings.Split(strings.TrimRight(a.Expr, "\n"), "\n") {
+			lines = append(lines, "    "+l)
+		}
+		lines = append(lines, "  |||,")
+	}
+	if a.For != "" {
+		lines = append(lines, "  'for': "+jsonnetString(a.For)+",")
+	}
+	lines = append(lines,
+		"  labels: {",
+		"    severity: "+jsonnetString(a.Severity)+",",
+		"  },",
+		"  annotations: {",
+		"    summary: "+jsonnetString(a.Summary)+",",
+		"    description: "+jsonnetString(a.Description)+",",
+		"  },",
+		"},",
+	)
+	return indentLines(lines, indent)
+}
+
+// indentLines joins the lines, indenting each by indent.
+func indentLines(lines []string, indent string) string {
+	for i, l := range lines {
+		lines[i] = indent + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// jsonnetString returns s as a single quoted jsonnet string.
+func jsonnetString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&b, `\u%04x`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// AlertGroupNames returns the literal names of the groups in the
+// prometheusAlerts of the jsonnet in content, which may be empty.
+func AlertGroupNames(filename string, content []byte) ([]string, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, nil
+	}
+	node, err := jsonnet.SnippetToAST(filename, string(content))
+	if err != nil {
+		return nil, err
+	}
+	groups := findAlertGroups(node)
+	if groups == nil {
+		return nil, nil
+	}
+
+	var names []string
+	for _, el := range groups.Elements {
+		if group, ok := el.Expr.(*ast.DesugaredObject); ok {
+			if name, ok := objectField(group, "name").(*ast.LiteralString); ok {
+				names = append(names, name.Value)
+			}
+		}
+	}
+	return names, nil
+}
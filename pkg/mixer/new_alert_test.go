@@ -0,0 +1,298 @@
+// Copyright 2018 mixtool authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mixer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testAlert = Alert{
+	Group:       "example",
+	Name:        "ExampleDown",
+	Expr:        `up{job="example"} == 0`,
+	For:         "5m",
+	Severity:    "critical",
+	Summary:     "Example is down.",
+	Description: "{{ $labels.instance }} is down, it's unreachable.",
+}
+
+func TestValidateAlert(t *testing.T) {
+	dir := t.TempDir()
+	if errs := ValidateAlert(testAlert, dir); len(errs) > 0 {
+		t.Errorf("unexpected errors for a valid alert: %v", errs)
+	}
+
+	invalid := Alert{
+		Group:       "example",
+		Name:        "example_down",
+		Expr:        "up ==",
+		For:         "5 minutes",
+		Severity:    "page",
+		Summary:     "example is down",
+		Description: "Example is down.",
+	}
+	errs := ValidateAlert(invalid, dir)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	for _, expected := range []string{
+		"invalid duration",
+		"could not parse expression",
+		"[alert-name-camelcase]",
+		"[alert-severity-rule]",
+		"[alert-description-templating]",
+		"[alert-summary-style]",
+	} {
+		if !strings.Contains(strings.Join(messages, "\n"), expected) {
+			t.Errorf("expected an error containing %q, got %v", expected, messages)
+		}
+	}
+
+	// Rules excluded by the .lint file are not validated.
+	lintConfig := "exclusions:\n  alert-summary-style:\n    entries:\n    - alert: ExampleDown\n"
+	if err := os.WriteFile(filepath.Join(dir, ".lint"), []byte(lintConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := testAlert
+	a.Summary = "lowercase summary"
+	if errs := ValidateAlert(a, dir); len(errs) > 0 {
+		t.Errorf("unexpected errors for an excluded rule: %v", errs)
+	}
+}
+
+func TestAddPrometheusAlert(t *testing.T) {
+	other := testAlert
+	other.Name = "ExampleSlow"
+	other.Expr = "rate(example_seconds_sum[5m])\n/\nrate(example_seconds_count[5m]) > 1"
+	other.For = ""
+
+	for _, tc := range []struct {
+		name     string
+		content  string
+		alert    Alert
+		expected string
+	}{
+		{
+			name:  "new file",
+			alert: testAlert,
+			expected: `{
+  prometheusAlerts+:: {
+    groups+: [
+      {
+        name: 'example',
+        rules: [
+          {
+            alert: 'ExampleDown',
+            expr: |||
+              up{job="example"} == 0
+            |||,
+            'for': '5m',
+            labels: {
+              severity: 'critical',
+            },
+            annotations: {
+              summary: 'Example is down.',
+              description: '{{ $labels.instance }} is down, it\'s unreachable.',
+            },
+          },
+        ],
+      },
+    ],
+  },
+}
+`,
+		},
+		{
+			name: "existing group",
+			content: `local config = import 'config.libsonnet';
+
+{
+  prometheusAlerts+:: {
+    groups+: [
+      {
+        name: 'example',
+        rules: [
+          { alert: 'ExampleDown' }  // Down.
+        ],
+      },
+    ],
+  },
+}
+`,
+			alert: other,
+			expected: `local config = import 'config.libsonnet';
+
+{
+  prometheusAlerts+:: {
+    groups+: [
+      {
+        name: 'example',
+        rules: [
+          { alert: 'ExampleDown' },  // Down.
+          {
+            alert: 'ExampleSlow',
+            expr: |||
+              rate(example_seconds_sum[5m])
+              /
+              rate(example_seconds_count[5m]) > 1
+            |||,
+            labels: {
+              severity: 'critical',
+            },
+            annotations: {
+              summary: 'Example is down.',
+              description: '{{ $labels.instance }} is down, it\'s unreachable.',
+            },
+          },
+        ],
+      },
+    ],
+  },
+}
+`,
+		},
+		{
+			name: "new group",
+			content: `(import 'config.libsonnet') + {
+  prometheusAlerts+:: {
+    groups+: [
+      { name: 'other', rules: [] },
+    ],
+  },
+}
+`,
+			alert: Alert{Group: "example", Name: "A", Expr: "up", Severity: "info", Summary: "A.", Description: "{{ $value }}"},
+			expected: `(import 'config.libsonnet') + {
+  prometheusAlerts+:: {
+    groups+: [
+      { name: 'other', rules: [] },
+      {
+        name: 'example',
+        rules: [
+          {
+            alert: 'A',
+            expr: |||
+              up
+            |||,
+            labels: {
+              severity: 'info',
+            },
+            annotations: {
+              summary: 'A.',
+              description: '{{ $value }}',
+            },
+          },
+        ],
+      },
+    ],
+  },
+}
+`,
+		},
+		{
+			name: "empty group",
+			content: `{
+  prometheusAlerts+:: {
+    groups+: [
+      {
+        name: 'example',
+        rules: [],
+      },
+    ],
+  },
+}
+`,
+			alert: Alert{Group: "example", Name: "A", Expr: "up", Severity: "info", Summary: "A.", Description: "{{ $value }}"},
+			expected: `{
+  prometheusAlerts+:: {
+    groups+: [
+      {
+        name: 'example',
+        rules: [
+          {
+            alert: 'A',
+            expr: |||
+              up
+            |||,
+            labels: {
+              severity: 'info',
+            },
+            annotations: {
+              summary: 'A.',
+              description: '{{ $value }}',
+            },
+          },
+        ],
+      },
+    ],
+  },
+}
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := AddPrometheusAlert("alerts.libsonnet", []byte(tc.content), tc.alert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, out)
+			}
+		})
+	}
+}
+
+func TestAddPrometheusAlertEvaluates(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "alerts.libsonnet")
+
+	var content []byte
+	for _, name := range []string{"ExampleDown", "ExampleUnreachable"} {
+		a := testAlert
+		a.Name = name
+		var err error
+		content, err = AddPrometheusAlert(filename, content, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Describe(filename, GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []AlertGroupInfo{{Name: "example", Alerts: []AlertInfo{
+		{Name: "ExampleDown", Severity: "critical"},
+		{Name: "ExampleUnreachable", Severity: "critical"},
+	}}}
+	if !reflect.DeepEqual(info.AlertGroups, expected) {
+		t.Errorf("expected alert groups %+v, got %+v", expected, info.AlertGroups)
+	}
+
+	if _, err := AddPrometheusAlert(filename, content, testAlert); err == nil {
+		t.Error("expected an error adding an alert that exists")
+	}
+	if _, err := AddPrometheusAlert(filename, []byte("{}"), testAlert); err == nil {
+		t.Error("expected an error for a file without alert groups")
+	}
+}
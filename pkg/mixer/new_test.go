@@ -15,16 +15,96 @@
 package mixer
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestNewGrafanaDashboard(t *testing.T) {
-	d, err := NewGrafanaDashboard()
+	templates, err := DashboardTemplates("")
 	if err != nil {
-		t.Errorf("failed to create new Grafana dashboard: %v", err)
+		t.Fatal(err)
 	}
-	if string(d) != dashboard {
-		t.Error("returned dashboard is not correct")
+	if len(templates) == 0 {
+		t.Fatal("no dashboard templates")
+	}
+
+	vendor := writeGrafonnet(t, t.TempDir())
+	for _, template := range templates {
+		t.Run(template, func(t *testing.T) {
+			d, err := NewGrafanaDashboard(DashboardOptions{
+				Template: template,
+				Name:     "my-dashboard",
+				Title:    `My "new" dashboard`,
+			})
+			if err != nil {
+				t.Fatalf("failed to create new Grafana dashboard: %v", err)
+			}
+
+			filename := filepath.Join(t.TempDir(), "my-dashboard.libsonnet")
+			if err := os.WriteFile(filename, d, 0644); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := Lint(&out, filename, LintOptions{JPaths: []string{vendor}, Grafana: true}); err != nil {
+				t.Fatalf("new dashboard does not pass lint: %v\n%s", err, out.String())
+			}
+
+			info, err := Describe(filename, GenerateOptions{JPaths: []string{vendor}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []DashboardInfo{{Filename: "my-dashboard.json", Title: `My "new" dashboard`, UID: "my-dashboard"}}
+			if !reflect.DeepEqual(info.Dashboards, expected) {
+				t.Errorf("expected dashboards %+v, got %+v", expected, info.Dashboards)
+			}
+		})
+	}
+}
+
+func TestNewGrafanaDashboardTemplateDirectory(t *testing.T) {
+	dir := t.TempDir()
+	custom := "{ grafanaDashboards+:: { [[ quote .Name ]]: { title: [[ quote .Title ]], uid: [[ quote .UID ]] } } }\n"
+	if err := os.WriteFile(filepath.Join(dir, "custom.libsonnet"), []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Templates in the directory take precedence over built-in ones.
+	if err := os.WriteFile(filepath.Join(dir, DefaultDashboardTemplate+".libsonnet"), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewGrafanaDashboard(DashboardOptions{Template: "custom", TemplateDirectory: dir, Name: "a", UID: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{ grafanaDashboards+:: { "a": { title: "a", uid: "b" } } }` + "\n"; string(d) != expected {
+		t.Errorf("expected %q, got %q", expected, d)
+	}
+
+	d, err = NewGrafanaDashboard(DashboardOptions{TemplateDirectory: dir, Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "{}\n" {
+		t.Errorf("expected the default template of the directory, got %q", d)
+	}
+
+	templates, err := DashboardTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(templates, []string{"custom", "overview", "timeseries"}) {
+		t.Errorf("unexpected templates %v", templates)
+	}
+
+	if _, err := NewGrafanaDashboard(DashboardOptions{Template: "unknown", TemplateDirectory: dir, Name: "a"}); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+	if _, err := NewGrafanaDashboard(DashboardOptions{Name: strings.Repeat("a", 41)}); err == nil {
+		t.Error("expected an error for a UID longer than 40 characters")
 	}
 }
 
@@ -47,3 +127,85 @@ func TestNewPrometheusRules(t *testing.T) {
 		t.Error("returned Prometheus rules is not correct")
 	}
 }
+
+func TestNewMixin(t *testing.T) {
+	files, err := NewMixin("my-app")
+	if err != nil {
+		t.Fatalf("failed to create new mixin: %v", err)
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"mixin.libsonnet", "config.libsonnet", "jsonnetfile.json", ".lint", "Makefile", "tests/alerts_test.yaml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("new mixin has no %s", name)
+		}
+	}
+
+	vendor := writeGrafonnet(t, dir)
+	filename := filepath.Join(dir, "mixin.libsonnet")
+	var out bytes.Buffer
+	options := LintOptions{JPaths: []string{vendor}, Grafana: true, Prometheus: true}
+	if err := Lint(&out, filename, options); err != nil {
+		t.Fatalf("new mixin does not pass lint: %v\n%s", err, out.String())
+	}
+
+	info, err := Describe(filename, GenerateOptions{JPaths: []string{vendor}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.AlertGroups) != 1 || len(info.AlertGroups[0].Alerts) != 1 || info.AlertGroups[0].Alerts[0].Name != "MyAppDown" {
+		t.Errorf("unexpected alerts: %+v", info.AlertGroups)
+	}
+	if len(info.Dashboards) != 1 || info.Dashboards[0].UID != "my-app-overview" {
+		t.Errorf("unexpected dashboards: %+v", info.Dashboards)
+	}
+}
+
+func TestNewMixinInvalidName(t *testing.T) {
+	for _, name := range []string{"", "1password", "my app", "my.app", "a-name-that-is-much-too-long-for-a-mixin"} {
+		if _, err := NewMixin(name); err == nil {
+			t.Errorf("expected an error for mixin name %q", name)
+		}
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"node_exporter": "NodeExporter",
+		"my-app":        "MyApp",
+		"myApp":         "MyApp",
+		"k8s":           "K8s",
+	} {
+		if actual := camelCase(name); actual != expected {
+			t.Errorf("expected %s for %s, got %s", expected, name, actual)
+		}
+	}
+}
+
+// writeGrafonnet writes the grafonnet used in tests into a vendor directory
+// in dir and returns it.
+func writeGrafonnet(t *testing.T, dir string) string {
+	t.Helper()
+	grafonnet, err := os.ReadFile("new_test_grafonnet.libsonnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vendor := filepath.Join(dir, "vendor")
+	grafonnetDir := filepath.Join(vendor, "github.com/grafana/grafonnet/gen/grafonnet-latest")
+	if err := os.MkdirAll(grafonnetDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(grafonnetDir, "main.libsonnet"), grafonnet, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return vendor
+}
@@ -0,0 +1,73 @@
+// The parts of grafonnet used by the dashboards of NewMixin and
+// NewGrafanaDashboard, as generated by github.com/grafana/grafonnet,
+// for testing without network access.
+local panel(type) = {
+  new(title): { type: type, title: title },
+  panelOptions: {
+    withDescription(value): { description: value },
+    withGridPos(h=8, w=12, x=null, y=null): { gridPos: { h: h, w: w, x: x, y: y } },
+  },
+  queryOptions: {
+    withDatasource(type, uid): { datasource: { type: type, uid: uid } },
+    withTargets(value): { targets: value },
+  },
+  standardOptions: {
+    withUnit(value): { fieldConfig+: { defaults+: { unit: value } } },
+  },
+};
+
+{
+  dashboard: {
+    new(title): { title: title, schemaVersion: 36, timezone: 'utc', time: { from: 'now-6h', to: 'now' } },
+    withUid(value): { uid: value },
+    withDescription(value): { description: value },
+    withTags(value): { tags: value },
+    withEditable(value=true): { editable: value },
+    withVariables(value): { templating+: { list: value } },
+    withPanels(value): { panels: value },
+    time: {
+      withFrom(value): { time+: { from: value } },
+    },
+    variable: {
+      datasource: {
+        new(name, type): { type: 'datasource', name: name, query: type },
+        generalOptions: {
+          withLabel(value): { label: value },
+        },
+      },
+      query: {
+        new(name, query=''): { type: 'query', name: name, query: query },
+        withDatasourceFromVariable(variable): { datasource: { type: variable.query, uid: '${%s}' % variable.name } },
+        generalOptions: {
+          withLabel(value): { label: value },
+        },
+        queryTypes: {
+          withLabelValues(label, metric=''): { query: 'label_values(%s, %s)' % [metric, label] },
+        },
+        selectionOptions: {
+          withMulti(value=true): { multi: value },
+          withIncludeAll(value=true, customAllValue=null):
+            { includeAll: value }
+            + (if customAllValue != null then { allValue: customAllValue } else {}),
+        },
+        refresh: {
+          onTime(): { refresh: 2 },
+        },
+      },
+    },
+  },
+  panel: {
+    row: {
+      new(title): { type: 'row', title: title, collapsed: false, panels: [] },
+      withGridPos(y): { gridPos: { h: 1, w: 24, x: 0, y: y } },
+    },
+    stat: panel('stat'),
+    timeSeries: panel('timeseries'),
+  },
+  query: {
+    prometheus: {
+      new(datasource, expr): { datasource: { type: 'prometheus', uid: datasource }, expr: expr },
+      withLegendFormat(value): { legendFormat: value },
+    },
+  },
+}
@@ -0,0 +1,25 @@
+{
+  prometheusAlerts+:: {
+    groups+: [
+      {
+        name: '[[ .Name ]]',
+        rules: [
+          {
+            alert: '[[ .AlertPrefix ]]Down',
+            expr: |||
+              up{%(selector)s} == 0
+            ||| % $._config,
+            'for': $._config.downFor,
+            labels: {
+              severity: 'critical',
+            },
+            annotations: {
+              summary: 'Target is down.',
+              description: '{{ $labels.instance }} of job {{ $labels.job }} has been down for more than %(downFor)s.' % $._config,
+            },
+          },
+        ],
+      },
+    ],
+  },
+}
@@ -0,0 +1,12 @@
+{
+  _config+:: {
+    // Selector for the targets monitored by this mixin.
+    selector: 'job="[[ .Name ]]"',
+
+    // Duration a target has to be down before alerting.
+    downFor: '5m',
+
+    dashboardNamePrefix: '[[ .Name ]] / ',
+    dashboardTags: ['[[ .Name ]]-mixin'],
+  },
+}
@@ -0,0 +1 @@
+(import 'overview.libsonnet')
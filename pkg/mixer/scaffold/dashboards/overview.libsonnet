@@ -0,0 +1,64 @@
+local g = import 'github.com/grafana/grafonnet/gen/grafonnet-latest/main.libsonnet';
+
+local dashboard = g.dashboard;
+local variable = dashboard.variable;
+local timeSeries = g.panel.timeSeries;
+local prometheus = g.query.prometheus;
+
+{
+  grafanaDashboards+:: {
+    local datasource =
+      variable.datasource.new('datasource', 'prometheus')
+      + variable.datasource.generalOptions.withLabel('Data source'),
+
+    local labelVariable(name, label, metric) =
+      variable.query.new(name)
+      + variable.query.generalOptions.withLabel(label)
+      + variable.query.withDatasourceFromVariable(datasource)
+      + variable.query.queryTypes.withLabelValues(name, metric)
+      + variable.query.selectionOptions.withMulti()
+      + variable.query.selectionOptions.withIncludeAll(customAllValue='.+')
+      + variable.query.refresh.onTime(),
+
+    local panel(title, description, unit, expr, legendFormat) =
+      timeSeries.new(title)
+      + timeSeries.panelOptions.withDescription(description)
+      + timeSeries.queryOptions.withDatasource('prometheus', '${datasource}')
+      + timeSeries.queryOptions.withTargets([
+        prometheus.new('${datasource}', expr)
+        + prometheus.withLegendFormat(legendFormat),
+      ])
+      + timeSeries.standardOptions.withUnit(unit),
+
+    '[[ .Name ]]-overview.json':
+      dashboard.new('%(dashboardNamePrefix)sOverview' % $._config)
+      + dashboard.withUid('[[ .Name ]]-overview')
+      + dashboard.withDescription('Overview of the targets monitored by the [[ .Name ]] mixin.')
+      + dashboard.withTags($._config.dashboardTags)
+      + dashboard.withEditable(false)
+      + dashboard.time.withFrom('now-1h')
+      + dashboard.withVariables([
+        datasource,
+        labelVariable('job', 'Job', 'up{%(selector)s}' % $._config),
+        labelVariable('instance', 'Instance', 'up{%(selector)s, job=~"$job"}' % $._config),
+      ])
+      + dashboard.withPanels([
+        panel(
+          'Targets up',
+          'Number of targets of each job that are up.',
+          'short',
+          'sum by (job) (up{job=~"$job", instance=~"$instance"})',
+          '{{job}}',
+        )
+        + timeSeries.panelOptions.withGridPos(h=8, w=12, x=0, y=0),
+        panel(
+          'CPU usage',
+          'CPU cores used by each instance.',
+          'short',
+          'sum by (instance) (rate(process_cpu_seconds_total{job=~"$job", instance=~"$instance"}[$__rate_interval]))',
+          '{{instance}}',
+        )
+        + timeSeries.panelOptions.withGridPos(h=8, w=12, x=12, y=0),
+      ]),
+  },
+}
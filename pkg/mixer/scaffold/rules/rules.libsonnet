@@ -0,0 +1,17 @@
+{
+  prometheusRules+:: {
+    groups+: [
+      {
+        name: '[[ .Name ]].rules',
+        rules: [
+          {
+            record: 'job:up:avg',
+            expr: |||
+              avg by (job) (up{%(selector)s})
+            ||| % $._config,
+          },
+        ],
+      },
+    ],
+  },
+}